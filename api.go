@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/release"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 接口返回错误时携带状态码
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// requireAuth为true的接口会生成release目录，未配置token与basic认证时不可用
+func (s *server) apiHandler(handle func(w http.ResponseWriter, r *http.Request) error, requireAuth bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requireAuth && s.request.Token == "" && s.request.BasicAuth == "" {
+			writeJson(w, http.StatusForbidden, map[string]string{"error": i18n.T("服务未配置--token或--basic-auth，接口不可用")})
+			return
+		}
+		if !s.verifyApi(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="app"`)
+			writeJson(w, http.StatusUnauthorized, map[string]string{"error": i18n.T("认证失败")})
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": i18n.T("只支持GET/POST")})
+			return
+		}
+		if err := handle(w, r); err != nil {
+			status := http.StatusBadGateway
+			if e, ok := err.(*apiError); ok {
+				status = e.status
+			}
+			logger.Error(i18n.T("接口请求失败"), "method", r.Method, "path", r.URL.Path, "status", status, "error", err)
+			writeJson(w, status, map[string]string{"error": err.Error()})
+		}
+	}
+}
+
+// 未配置token与basic认证时不校验
+func (s *server) verifyApi(r *http.Request) bool {
+	if s.request.Token == "" && s.request.BasicAuth == "" {
+		return true
+	}
+	if s.request.Token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.request.Token)) == 1 {
+			return true
+		}
+	}
+	if s.request.BasicAuth != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			return subtle.ConstantTimeCompare([]byte(user+":"+pass), []byte(s.request.BasicAuth)) == 1
+		}
+	}
+	return false
+}
+
+func (s *server) searchRequest(r *http.Request) (*models.Search, error) {
+	name := r.FormValue("name")
+	if name == "" {
+		return nil, &apiError{http.StatusBadRequest, i18n.T("必须指定镜像名称name")}
+	}
+	if s.request.Type != "" && strings.ToLower(s.request.Type) != models.DockerHub && s.request.Url == "" {
+		return nil, &apiError{http.StatusInternalServerError, i18n.T("服务未配置镜像仓库地址-url")}
+	}
+	return &models.Search{
+		Type:    s.request.Type,
+		Url:     s.request.Url,
+		Name:    name,
+		Version: r.FormValue("v"),
+	}, nil
+}
+
+// GET /api/tags?name=moebius/release/website&v=v1.9 镜像tag列表，v为空时返回所有tag
+func (s *server) apiTags(w http.ResponseWriter, r *http.Request) error {
+	searchRequest, err := s.searchRequest(r)
+	if err != nil {
+		return err
+	}
+	it, err := releaseClient.Search(r.Context(), searchRequest)
+	if err != nil {
+		return err
+	}
+	tags := []string{}
+	for _, t := range it {
+		if searchRequest.Version == "" || strings.Contains(t.ImageTag, searchRequest.Version) {
+			tags = append(tags, t.ImageTag)
+		}
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"name": searchRequest.Name, "tags": tags})
+	return nil
+}
+
+// GET /api/latest?name=moebius/release/website&v=v1.9 指定版本下的最新镜像
+func (s *server) apiLatest(w http.ResponseWriter, r *http.Request) error {
+	searchRequest, err := s.searchRequest(r)
+	if err != nil {
+		return err
+	}
+	latest, err := releaseClient.Latest(r.Context(), searchRequest)
+	if err != nil {
+		return err
+	}
+	if latest == nil {
+		return &apiError{http.StatusNotFound, i18n.T("%s：未查询到最新版本", searchRequest.Name)}
+	}
+	result := map[string]string{
+		"name":  searchRequest.Name,
+		"tag":   latest.ImageTag,
+		"image": searchRequest.Name + ":" + latest.ImageTag,
+	}
+	if latest.Digest != "" {
+		result["digest"] = latest.Digest
+	}
+	writeJson(w, http.StatusOK, result)
+	return nil
+}
+
+// GET /api/plugin?name=xxx&v=latest 插件最新版本下载地址，name为空时返回所有插件
+func (s *server) apiPlugin(w http.ResponseWriter, r *http.Request) error {
+	if !releaseClient.HasPluginSources(s.request.PluginUrl) {
+		return &apiError{http.StatusNotFound, i18n.T("服务未配置插件列表地址--plugin-url或--plugin-config")}
+	}
+	searchRequest := &models.PluginSearch{
+		Url:     s.request.PluginUrl,
+		Name:    r.FormValue("name"),
+		Version: r.FormValue("v"),
+	}
+	plugins, err := releaseClient.LatestPlugins(r.Context(), searchRequest)
+	if err != nil {
+		return err
+	}
+	if searchRequest.Name != "" && len(plugins) == 0 {
+		return &apiError{http.StatusNotFound, i18n.T("未查询到插件：%s", searchRequest.Name)}
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"plugins": plugins})
+	return nil
+}
+
+// GET/POST /api/release?v=v1.9&format=helm&set=website=v1.9-10 生成release目录并以tar.gz下载
+func (s *server) apiRelease(w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return &apiError{http.StatusBadRequest, err.Error()}
+	}
+	releaseRequest := s.request.Release
+	if v := r.FormValue("v"); v != "" {
+		releaseRequest.Version = v
+	}
+	if format := r.FormValue("format"); format != "" {
+		releaseRequest.Format = format
+	}
+	if chartName := r.FormValue("chart-name"); chartName != "" {
+		releaseRequest.ChartName = chartName
+	}
+	releaseRequest.Sets = r.Form["set"]
+	releaseRequest.Fresh = true
+
+	dir, err := ioutil.TempDir("", "release")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	releaseRequest.ReleasePath = filepath.Join(dir, "release")
+	releaseRequest.Apply = false
+
+	result, err := releaseClient.Generate(r.Context(), &releaseRequest)
+	if err != nil {
+		if errors.Is(err, release.ErrInvalidFormat) {
+			return &apiError{http.StatusBadRequest, err.Error()}
+		}
+		return fmt.Errorf(i18n.T("生成release失败：%w"), err)
+	}
+
+	name := "release"
+	if releaseRequest.Version != "" {
+		name = "release-" + releaseRequest.Version
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar.gz"`, name))
+	if err := utils.TarGz(result.ReleasePath, name, w); err != nil {
+		logger.Error(i18n.T("打包release目录失败"), "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/cache"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/urfave/cli"
+	"time"
+)
+
+var cacheCommand = cli.Command{
+	Name:  "cache",
+	Usage: "镜像tag缓存: app cache ls / app cache clear",
+	Subcommands: []cli.Command{
+		{
+			Name:  "ls",
+			Usage: "列出缓存的镜像tag列表",
+			Action: func(context *cli.Context) error {
+				dir, err := tagCacheDir(context)
+				if err != nil {
+					fatal(i18n.T("无法确定缓存目录，请通过--cache-dir指定：%s", err))
+				}
+				c := cache.New(dir, context.GlobalDuration("cache-ttl"))
+				entries, err := c.List()
+				if err != nil {
+					fatal(i18n.T("读取缓存失败：%s", err))
+				}
+				for _, entry := range entries {
+					age := time.Since(entry.Updated).Truncate(time.Second)
+					state := ""
+					if c.TTL <= 0 || age > c.TTL {
+						state = i18n.T(" (已过期)")
+					}
+					fmt.Println(i18n.T("%s %s %s %d个tag %s前%s", entry.Backend, entry.Registry, entry.Image, len(entry.Tags), age, state))
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "clear",
+			Usage: "删除缓存",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "image",
+					Usage: "只删除指定镜像的缓存，例：moebius/release/website",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				dir, err := tagCacheDir(context)
+				if err != nil {
+					fatal(i18n.T("无法确定缓存目录，请通过--cache-dir指定：%s", err))
+				}
+				c := cache.New(dir, context.GlobalDuration("cache-ttl"))
+				n, err := c.Clear(context.String("image"))
+				if err != nil {
+					fatal(i18n.T("删除缓存失败：%s", err))
+				}
+				logger.Info(i18n.T("已删除缓存"), "count", n)
+				return nil
+			},
+		},
+	},
+}
+
+// --cache-dir，未指定时为用户缓存目录下的app/tags
+func tagCacheDir(context *cli.Context) (string, error) {
+	if dir := context.GlobalString("cache-dir"); dir != "" {
+		return dir, nil
+	}
+	return cache.DefaultDir()
+}
@@ -2,4 +2,7 @@ module github.com/antmoveh/micro-version-management
 
 go 1.13
 
-require github.com/urfave/cli v1.22.2
+require (
+	github.com/urfave/cli v1.22.2
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,32 +1,298 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/cache"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/metrics"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/notify"
+	"github.com/antmoveh/micro-version-management/pkg/release"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
 	"github.com/urfave/cli"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const usage = `这是一个获取最新release版本镜像的工具`
 
+// 未配置通知时为nil，Send不做任何处理
+var notifier *notify.Notifier
+
+// 镜像tag缓存，--no-cache时为nil
+var tagCache *cache.Cache
+
+// 指标文件路径，为空时不写入
+var metricsFile string
+
+// 镜像查询与release生成，在app.Before中根据全局参数创建
+var releaseClient = &release.Client{}
+
+// 命令执行的context，收到SIGINT/SIGTERM时取消
+var appContext = context.Background()
+
 func main() {
+	// 帮助信息在app.Before之前输出，需要先确定语言
+	lang := langFromArgs(os.Args)
+	if lang == "" {
+		lang = os.Getenv("LANG")
+	}
+	i18n.SetLang(lang)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	appContext = ctx
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warn(i18n.T("收到退出信号，正在取消，再次发送信号强制退出"), "signal", sig.String())
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+
 	app := cli.NewApp()
 	app.Name = "app"
-	app.Usage = usage
+	app.Usage = i18n.T(usage)
 
 	app.Commands = []cli.Command{
 		searchCommand,
 		releaseCommand,
 		pluginCommand,
+		composeCommand,
+		bumpCommand,
+		lintCommand,
+		promoteCommand,
+		retagCommand,
+		pruneCommand,
+		watchCommand,
+		notifyCommand,
+		serveCommand,
+		cacheCommand,
 	}
 
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "notify",
+			Usage:  "webhook通知配置文件",
+			EnvVar: "APP_NOTIFY_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "plugin-config",
+			Usage:  "插件列表来源配置文件，配置多个插件列表地址、认证与缓存",
+			EnvVar: "APP_PLUGIN_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "cache-dir",
+			Usage: "镜像tag缓存目录，默认为用户缓存目录下的app/tags",
+		},
+		cli.DurationFlag{
+			Name:   "cache-ttl",
+			Usage:  "镜像tag缓存有效期，为0时不使用缓存",
+			Value:  10 * time.Minute,
+			EnvVar: "APP_CACHE_TTL",
+		},
+		cli.BoolFlag{
+			Name:  "no-cache",
+			Usage: "不读取也不写入镜像tag缓存",
+		},
+		cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "忽略已有缓存，重新查询镜像仓库并更新缓存",
+		},
+		cli.DurationFlag{
+			Name:   "http-timeout",
+			Usage:  "镜像仓库单次请求超时时间",
+			Value:  30 * time.Second,
+			EnvVar: "APP_HTTP_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "insecure-registry",
+			Usage:  "跳过证书校验的镜像仓库地址，用于自签名证书的nexus/harbor，可重复使用: --insecure-registry repository.xxx.com:8443",
+			EnvVar: "APP_INSECURE_REGISTRY",
+		},
+		cli.IntFlag{
+			Name:   "http-retries",
+			Usage:  "镜像仓库请求失败、返回5xx或429时的重试次数",
+			Value:  3,
+			EnvVar: "APP_HTTP_RETRIES",
+		},
+		cli.StringFlag{
+			Name:   "metrics-file",
+			Usage:  "命令执行结束后以prometheus文本格式写入指标，供node_exporter textfile collector采集",
+			EnvVar: "APP_METRICS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Usage:  "日志级别：debug/info/warn/error",
+			Value:  "info",
+			EnvVar: "APP_LOG_LEVEL",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "日志格式：text/json，日志输出到标准错误",
+			Value:  logger.FormatText,
+			EnvVar: "APP_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "lang",
+			Usage:  "界面语言：zh/en，默认按LANG环境变量",
+			EnvVar: "LANG",
+		},
+	}
+	app.Flags = translateFlags(app.Flags)
+	translateUsage(app.Commands)
+
 	app.Before = func(context *cli.Context) error {
 
-		log.SetOutput(os.Stdout)
+		level, err := logger.ParseLevel(context.GlobalString("log-level"))
+		if err != nil {
+			fatal(err)
+		}
+		if err := logger.Configure(level, context.GlobalString("log-format"), os.Stderr); err != nil {
+			fatal(err)
+		}
+		log.SetFlags(0)
+		log.SetOutput(logger.Writer(logger.InfoLevel))
+		metricsFile = context.GlobalString("metrics-file")
+		repository.Configure(context.GlobalDuration("http-timeout"), context.GlobalInt("http-retries"))
+		repository.SetInsecureRegistries(context.GlobalStringSlice("insecure-registry"))
+		if !context.GlobalBool("no-cache") {
+			// 无法确定用户缓存目录时不缓存tag列表
+			if dir, err := tagCacheDir(context); err != nil {
+				logger.Debug(i18n.T("无法确定用户缓存目录，不缓存镜像tag列表"), "error", err)
+			} else {
+				tagCache = cache.New(dir, context.GlobalDuration("cache-ttl"))
+				tagCache.Refresh = context.GlobalBool("refresh")
+			}
+		}
+		if path := context.GlobalString("notify"); path != "" {
+			n, err := notify.LoadConfig(path)
+			if err != nil {
+				fatal(i18n.T("读取通知配置文件失败：%s", err))
+			}
+			notifier = n
+		}
+		releaseClient = &release.Client{Cache: tagCache, Notifier: notifier}
+		pluginConfig := &models.PluginConfig{}
+		if path := context.GlobalString("plugin-config"); path != "" {
+			c, err := release.LoadPluginConfig(path)
+			if err != nil {
+				fatal(i18n.T("读取插件列表配置文件失败：%s", err))
+			}
+			pluginConfig = c
+		}
+		releaseClient.PluginSources = pluginConfig.Sources
+		if !context.GlobalBool("no-cache") {
+			dir, ttl := pluginConfig.CacheDir, pluginConfig.CacheTTL
+			if dir == "" {
+				// 无法确定用户缓存目录时不缓存插件列表
+				d, err := cache.DefaultIndexDir()
+				if err != nil {
+					logger.Debug(i18n.T("无法确定用户缓存目录，不缓存插件列表"), "error", err)
+				}
+				dir = d
+			}
+			if ttl == 0 {
+				ttl = context.GlobalDuration("cache-ttl")
+			}
+			if dir != "" {
+				releaseClient.PluginCache = cache.NewIndexCache(dir, ttl)
+				releaseClient.PluginCache.Refresh = context.GlobalBool("refresh")
+				if pluginConfig.CacheMaxStale > 0 {
+					releaseClient.PluginCache.MaxStale = pluginConfig.CacheMaxStale
+				}
+			}
+		}
+		return nil
+	}
+
+	app.After = func(context *cli.Context) error {
+		writeMetricsFile()
 		return nil
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 }
+
+// 输出错误并退出，退出前写入指标文件，收到退出信号导致的失败以130退出
+func fatal(v ...interface{}) {
+	writeMetricsFile()
+	if appContext.Err() != nil {
+		logger.Error(i18n.T("已取消"), "error", fmt.Sprint(v...))
+		os.Exit(130)
+	}
+	logger.Error(fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+func writeMetricsFile() {
+	if metricsFile == "" {
+		return
+	}
+	if err := metrics.WriteFile(metricsFile); err != nil {
+		logger.Warn(i18n.T("写入指标文件失败"), "error", err)
+	}
+}
+
+// 在解析参数前获取--lang，未指定时返回空
+func langFromArgs(args []string) string {
+	for i := 1; i < len(args); i++ {
+		arg := strings.TrimLeft(args[i], "-")
+		if arg == args[i] {
+			continue
+		}
+		if arg == "lang" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "lang=") {
+			return strings.TrimPrefix(arg, "lang=")
+		}
+	}
+	return ""
+}
+
+// 按当前语言翻译命令与参数说明
+func translateUsage(commands []cli.Command) {
+	for i := range commands {
+		commands[i].Usage = i18n.T(commands[i].Usage)
+		commands[i].ArgsUsage = i18n.T(commands[i].ArgsUsage)
+		commands[i].Flags = translateFlags(commands[i].Flags)
+		translateUsage(commands[i].Subcommands)
+	}
+}
+
+func translateFlags(flags []cli.Flag) []cli.Flag {
+	translated := make([]cli.Flag, 0, len(flags))
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case cli.StringFlag:
+			f.Usage = i18n.T(f.Usage)
+			flag = f
+		case cli.StringSliceFlag:
+			f.Usage = i18n.T(f.Usage)
+			flag = f
+		case cli.BoolFlag:
+			f.Usage = i18n.T(f.Usage)
+			flag = f
+		case cli.IntFlag:
+			f.Usage = i18n.T(f.Usage)
+			flag = f
+		case cli.DurationFlag:
+			f.Usage = i18n.T(f.Usage)
+			flag = f
+		}
+		translated = append(translated, flag)
+	}
+	return translated
+}
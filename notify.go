@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/urfave/cli"
+)
+
+var notifyCommand = cli.Command{
+	Name:  "notify",
+	Usage: "webhook通知: app --notify notify.yaml notify test --event release-generated",
+	Subcommands: []cli.Command{
+		{
+			Name:  "test",
+			Usage: "发送测试事件，检查webhook配置",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "event",
+					Usage: "事件类型：release-generated/release-applied/apply-failed/new-tag-detected",
+					Value: models.EventReleaseGenerated,
+				},
+			},
+			Action: func(context *cli.Context) error {
+				if notifier == nil {
+					fatal(i18n.T("未指定通知配置文件，例：app --notify notify.yaml notify test"))
+				}
+				if err := notifier.Send(appContext, testEvent(context.String("event"))); err != nil {
+					fatal(err)
+				}
+				logger.Info(i18n.T("测试事件发送完成"))
+				return nil
+			},
+		},
+	},
+}
+
+func testEvent(eventType string) *models.NotifyEvent {
+	event := &models.NotifyEvent{Type: eventType, Version: "v1.9"}
+	switch eventType {
+	case models.EventNewTagDetected:
+		event.Image = "moebius/release/website"
+		event.OldTag = "v1.9-10"
+		event.NewTag = "v1.9-11"
+	default:
+		event.ReleasePath = "/tmp/release"
+		event.Images = []*models.ReleaseImage{{Component: "website", Name: "moebius/release/website", Tag: "v1.9-11"}}
+		if eventType == models.EventApplyFailed {
+			event.Error = "exit status 1"
+		}
+	}
+	return event
+}
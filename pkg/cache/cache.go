@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 缓存的镜像tag列表，按 仓库类型+仓库地址+认证信息+镜像名称 区分
+type Entry struct {
+	Backend  string              `json:"backend"`
+	Registry string              `json:"registry"`
+	Auth     string              `json:"auth,omitempty"` // 仓库地址中用户名密码的sha256摘要，不同凭据的结果分开缓存
+	Image    string              `json:"image"`
+	Updated  time.Time           `json:"updated"`
+	Tags     []*models.ImageTags `json:"tags"`
+	File     string              `json:"-"`
+}
+
+// 镜像tag列表磁盘缓存，为nil时不缓存
+type Cache struct {
+	Dir     string
+	TTL     time.Duration
+	Refresh bool // 不读取缓存，查询结果仍写入缓存
+}
+
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// 默认缓存目录，为用户缓存目录下的app/tags
+func DefaultDir() (string, error) {
+	return userCacheDir("tags")
+}
+
+func userCacheDir(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "app", name), nil
+}
+
+// 仓库类型为空时为dockerHub，仓库地址去掉用户名密码，用户名密码只保留摘要
+func key(backend, registry string) (string, string, string) {
+	backend = strings.ToLower(backend)
+	if backend == "" {
+		backend = models.DockerHub
+	}
+	auth := ""
+	if u, err := url2.Parse(registry); err == nil {
+		if u.User != nil {
+			sum := sha256.Sum256([]byte(u.User.String()))
+			auth = hex.EncodeToString(sum[:])
+		}
+		u.User = nil
+		registry = strings.TrimSuffix(u.String(), "/")
+	}
+	return backend, registry, auth
+}
+
+func (c *Cache) path(backend, registry, auth, image string) string {
+	sum := sha256.Sum256([]byte(backend + "\n" + registry + "\n" + auth + "\n" + image))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// 读取未过期的缓存
+func (c *Cache) Get(backend, registry, image string) ([]*models.ImageTags, bool) {
+	if c == nil || c.Refresh || c.TTL <= 0 {
+		return nil, false
+	}
+	backend, registry, auth := key(backend, registry)
+	entry, err := readEntry(c.path(backend, registry, auth, image))
+	if err != nil || entry.Backend != backend || entry.Registry != registry || entry.Auth != auth || entry.Image != image {
+		return nil, false
+	}
+	if time.Since(entry.Updated) > c.TTL {
+		return nil, false
+	}
+	return entry.Tags, true
+}
+
+// 写入缓存，先写临时文件再重命名；缓存目录权限为0700，文件为0600，避免其他用户读取或篡改
+func (c *Cache) Put(backend, registry, image string, tags []*models.ImageTags) error {
+	if c == nil || c.TTL <= 0 {
+		return nil
+	}
+	backend, registry, auth := key(backend, registry)
+	entry := &Entry{
+		Backend:  backend,
+		Registry: registry,
+		Auth:     auth,
+		Image:    image,
+		Updated:  time.Now(),
+		Tags:     tags,
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.Dir, ".cache")
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(backend, registry, auth, image))
+}
+
+// 删除指定镜像的缓存，包括其他凭据查询的缓存，镜像tag被删除后调用
+func (c *Cache) Delete(backend, registry, image string) error {
+	if c == nil {
+		return nil
+	}
+	backend, registry, _ = key(backend, registry)
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Backend != backend || entry.Registry != registry || entry.Image != image {
+			continue
+		}
+		if err := os.Remove(entry.File); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 所有缓存，按仓库地址与镜像名称排序
+func (c *Cache) List() ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, file := range files {
+		entry, err := readEntry(file)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Registry != entries[j].Registry {
+			return entries[i].Registry < entries[j].Registry
+		}
+		return entries[i].Image < entries[j].Image
+	})
+	return entries, nil
+}
+
+// 删除缓存，image为空时删除所有缓存，返回删除数量
+func (c *Cache) Clear(image string) (int, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, entry := range entries {
+		if image != "" && entry.Image != image {
+			continue
+		}
+		if err := os.Remove(entry.File); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func readEntry(file string) (*Entry, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil, err
+	}
+	entry.File = file
+	return entry, nil
+}
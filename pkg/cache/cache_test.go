@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, ttl time.Duration) *Cache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(filepath.Join(dir, "tags"), ttl)
+}
+
+func tags(names ...string) []*models.ImageTags {
+	it := []*models.ImageTags{}
+	for _, name := range names {
+		it = append(it, &models.ImageTags{ImageName: "moebius/release/website", ImageTag: name})
+	}
+	return it
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := newTestCache(t, 20*time.Millisecond)
+	defer os.RemoveAll(filepath.Dir(c.Dir))
+	if err := c.Put("harbor", "http://harbor.xxx.com", "moebius/release/website", tags("v1.9-1")); err != nil {
+		t.Fatal(err)
+	}
+	it, ok := c.Get("harbor", "http://harbor.xxx.com", "moebius/release/website")
+	if !ok || len(it) != 1 || it[0].ImageTag != "v1.9-1" {
+		t.Fatalf("got %v, %v", it, ok)
+	}
+
+	c.Refresh = true
+	if _, ok := c.Get("harbor", "http://harbor.xxx.com", "moebius/release/website"); ok {
+		t.Fatal("Refresh should ignore the cache")
+	}
+	c.Refresh = false
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("harbor", "http://harbor.xxx.com", "moebius/release/website"); ok {
+		t.Fatal("expired cache was returned")
+	}
+
+	disabled := New(c.Dir, 0)
+	if err := disabled.Put("harbor", "http://harbor.xxx.com", "moebius/release/gateway", tags("v1.9-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := New(c.Dir, time.Hour).Get("harbor", "http://harbor.xxx.com", "moebius/release/gateway"); ok {
+		t.Fatal("a zero TTL should not write the cache")
+	}
+
+	var nilCache *Cache
+	if _, ok := nilCache.Get("harbor", "", "website"); ok || nilCache.Put("harbor", "", "website", nil) != nil || nilCache.Delete("harbor", "", "website") != nil {
+		t.Fatal("a nil cache should be a no-op")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	c := newTestCache(t, time.Hour)
+	defer os.RemoveAll(filepath.Dir(c.Dir))
+	if err := c.Put("", "http://alice:a@registry.xxx.com/", "website", tags("v1.9-1")); err != nil {
+		t.Fatal(err)
+	}
+	// 仓库类型为空即dockerHub，地址末尾的/不影响
+	if _, ok := c.Get("dockerHub", "http://alice:a@registry.xxx.com", "website"); !ok {
+		t.Fatal("expected a cache hit for the same credentials")
+	}
+	for _, registry := range []string{"http://registry.xxx.com", "http://bob:b@registry.xxx.com", "http://alice:b@registry.xxx.com"} {
+		if _, ok := c.Get("", registry, "website"); ok {
+			t.Fatalf("cache for alice was returned for %s", registry)
+		}
+	}
+	if _, ok := c.Get("harbor", "http://alice:a@registry.xxx.com", "website"); ok {
+		t.Fatal("cache was shared across backends")
+	}
+	if _, ok := c.Get("", "http://alice:a@registry.xxx.com", "gateway"); ok {
+		t.Fatal("cache was shared across images")
+	}
+
+	// 缓存文件中不保存用户名密码
+	entries, err := c.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("got %v, %v", entries, err)
+	}
+	b, _ := ioutil.ReadFile(entries[0].File)
+	if entries[0].Registry != "http://registry.xxx.com" || entries[0].Auth == "" || strings.Contains(string(b), "alice") {
+		t.Fatalf("credentials leaked into the cache: %s", b)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	c := newTestCache(t, time.Hour)
+	defer os.RemoveAll(filepath.Dir(c.Dir))
+	for _, registry := range []string{"http://alice:a@harbor.xxx.com", "http://bob:b@harbor.xxx.com"} {
+		for _, image := range []string{"website", "gateway"} {
+			if err := c.Put("harbor", registry, image, tags("v1.9-1")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// 删除tag后清除所有凭据下该镜像的缓存
+	if err := c.Delete("harbor", "http://harbor.xxx.com", "website"); err != nil {
+		t.Fatal(err)
+	}
+	for _, registry := range []string{"http://alice:a@harbor.xxx.com", "http://bob:b@harbor.xxx.com"} {
+		if _, ok := c.Get("harbor", registry, "website"); ok {
+			t.Fatalf("website cache for %s was not deleted", registry)
+		}
+		if _, ok := c.Get("harbor", registry, "gateway"); !ok {
+			t.Fatalf("gateway cache for %s was deleted", registry)
+		}
+	}
+
+	n, err := c.Clear("gateway")
+	if err != nil || n != 2 {
+		t.Fatalf("got %d, %v, want 2", n, err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Fatalf("got %d entries after clear", len(entries))
+	}
+}
+
+func TestCachePermissions(t *testing.T) {
+	c := newTestCache(t, time.Hour)
+	defer os.RemoveAll(filepath.Dir(c.Dir))
+	if err := c.Put("registry", "http://registry.xxx.com", "website", tags("v1.9-1")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("cache dir mode %s, want 0700", info.Mode().Perm())
+	}
+	entries, _ := c.List()
+	for _, entry := range entries {
+		info, err := os.Stat(entry.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("cache file mode %s, want 0600", info.Mode().Perm())
+		}
+	}
+}
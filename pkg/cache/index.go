@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 过期缓存用于降级的最长时间
+const DefaultIndexMaxStale = 7 * 24 * time.Hour
+
+// 缓存的插件列表原始内容，按去掉用户名密码的地址与认证信息摘要区分
+type IndexEntry struct {
+	Url          string    `json:"url"`
+	Auth         string    `json:"auth,omitempty"` // 认证信息的sha256摘要，不同凭据的结果分开缓存
+	Updated      time.Time `json:"updated"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	Body         []byte    `json:"body"`
+}
+
+// 插件列表磁盘缓存，为nil时不缓存
+// 过期的缓存仍会返回，用于条件请求及插件列表地址无法访问时的降级
+type IndexCache struct {
+	Dir      string
+	TTL      time.Duration
+	MaxStale time.Duration // 过期超过该时间的缓存不再用于降级，为0时使用DefaultIndexMaxStale
+	Refresh  bool          // 缓存视为已过期，查询结果仍写入缓存
+}
+
+func NewIndexCache(dir string, ttl time.Duration) *IndexCache {
+	return &IndexCache{Dir: dir, TTL: ttl, MaxStale: DefaultIndexMaxStale}
+}
+
+// 默认缓存目录，为用户缓存目录下的app/plugins
+func DefaultIndexDir() (string, error) {
+	return userCacheDir("plugins")
+}
+
+// 返回去掉用户名密码的地址与认证信息摘要，没有认证信息时摘要为空
+func indexKey(source *models.PluginSource) (string, string) {
+	url, auth := source.Url, ""
+	if u, err := url2.Parse(url); err == nil {
+		if u.User != nil {
+			auth = "userinfo:" + u.User.String()
+		}
+		u.User = nil
+		url = u.String()
+	}
+	if source.Token != "" {
+		auth = "token:" + source.Token
+	} else if source.Username != "" {
+		auth = "basic:" + source.Username + ":" + source.Password
+	}
+	if auth == "" {
+		return url, ""
+	}
+	sum := sha256.Sum256([]byte(auth))
+	return url, hex.EncodeToString(sum[:])
+}
+
+func (c *IndexCache) path(url, auth string) string {
+	sum := sha256.Sum256([]byte(url + "\n" + auth))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// 读取缓存，不存在时返回nil；fresh为true时缓存未过期
+func (c *IndexCache) Get(source *models.PluginSource) (*IndexEntry, bool) {
+	if c == nil || c.TTL <= 0 {
+		return nil, false
+	}
+	url, auth := indexKey(source)
+	b, err := ioutil.ReadFile(c.path(url, auth))
+	if err != nil {
+		return nil, false
+	}
+	entry := &IndexEntry{}
+	if err := json.Unmarshal(b, entry); err != nil || entry.Url != url || entry.Auth != auth {
+		return nil, false
+	}
+	return entry, !c.Refresh && time.Since(entry.Updated) <= c.TTL
+}
+
+// 过期的缓存是否仍可用于降级
+func (c *IndexCache) Usable(entry *IndexEntry) bool {
+	maxStale := c.MaxStale
+	if maxStale <= 0 {
+		maxStale = DefaultIndexMaxStale
+	}
+	return time.Since(entry.Updated) <= c.TTL+maxStale
+}
+
+// 写入缓存，先写临时文件再重命名；缓存目录权限为0700，文件为0600，避免其他用户读取需认证的插件列表
+func (c *IndexCache) Put(source *models.PluginSource, entry *IndexEntry) error {
+	if c == nil || c.TTL <= 0 {
+		return nil
+	}
+	entry.Url, entry.Auth = indexKey(source)
+	entry.Updated = time.Now()
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.Dir, ".cache")
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(entry.Url, entry.Auth))
+}
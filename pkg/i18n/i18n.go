@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 界面语言
+const (
+	Zh = "zh"
+	En = "en"
+)
+
+var lang = Zh
+
+// en、en_US.UTF-8等以en开头的为英文，其余为中文
+func Parse(l string) string {
+	if strings.HasPrefix(strings.ToLower(l), En) {
+		return En
+	}
+	return Zh
+}
+
+func SetLang(l string) {
+	lang = Parse(l)
+}
+
+func Lang() string {
+	return lang
+}
+
+// 翻译消息，key为中文消息，可包含fmt格式；英文目录中不存在时使用中文
+// 不传args时返回翻译后的格式字符串，可用于fmt.Errorf("...%w", err)
+func T(key string, args ...interface{}) string {
+	msg := key
+	if lang == En {
+		if m, ok := en[key]; ok {
+			msg = m
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// 输出时按当前语言翻译的错误，可作为errors.Is比较的哨兵错误
+type Error string
+
+func NewError(key string) error {
+	return Error(key)
+}
+
+func (e Error) Error() string {
+	return T(string(e))
+}
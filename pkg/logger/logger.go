@@ -0,0 +1,192 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志级别
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+var ErrInvalidLevel = i18n.NewError("日志级别不正确，支持debug/info/warn/error")
+var ErrInvalidFormat = i18n.NewError("日志格式不正确，支持text/json")
+
+// 日志格式
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, ErrInvalidLevel
+}
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	level            = InfoLevel
+	format           = FormatText
+)
+
+// 设置日志级别、格式与输出，w为nil时输出到标准错误
+func Configure(l Level, f string, w io.Writer) error {
+	f = strings.ToLower(f)
+	if f == "" {
+		f = FormatText
+	}
+	if f != FormatText && f != FormatJson {
+		return ErrInvalidFormat
+	}
+	if w == nil {
+		w = os.Stderr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	level, format, out = l, f, w
+	return nil
+}
+
+// fields为键值对：logger.Info("搜索该镜像所有tag", "image", name)
+func Debug(msg string, fields ...interface{}) {
+	write(DebugLevel, msg, fields)
+}
+
+func Info(msg string, fields ...interface{}) {
+	write(InfoLevel, msg, fields)
+}
+
+func Warn(msg string, fields ...interface{}) {
+	write(WarnLevel, msg, fields)
+}
+
+func Error(msg string, fields ...interface{}) {
+	write(ErrorLevel, msg, fields)
+}
+
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l >= level
+}
+
+func write(l Level, msg string, fields []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l < level {
+		return
+	}
+	now := time.Now()
+	buf := &bytes.Buffer{}
+	if format == FormatJson {
+		buf.WriteString(`{"time":`)
+		writeJson(buf, now.Format(time.RFC3339))
+		buf.WriteString(`,"level":`)
+		writeJson(buf, l.String())
+		buf.WriteString(`,"msg":`)
+		writeJson(buf, msg)
+		for i := 0; i < len(fields); i += 2 {
+			buf.WriteByte(',')
+			writeJson(buf, key(fields, i))
+			buf.WriteByte(':')
+			writeJson(buf, value(fields, i))
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now.Format("2006/01/02 15:04:05"))
+		buf.WriteByte(' ')
+		buf.WriteString(strings.ToUpper(l.String()))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+		for i := 0; i < len(fields); i += 2 {
+			buf.WriteByte(' ')
+			buf.WriteString(key(fields, i))
+			buf.WriteByte('=')
+			buf.WriteString(quote(fmt.Sprint(value(fields, i))))
+		}
+		buf.WriteByte('\n')
+	}
+	_, _ = out.Write(buf.Bytes())
+}
+
+func key(fields []interface{}, i int) string {
+	if k, ok := fields[i].(string); ok {
+		return k
+	}
+	return fmt.Sprint(fields[i])
+}
+
+// 键值对个数为奇数时最后一个值为空，error与Stringer输出为字符串
+func value(fields []interface{}, i int) interface{} {
+	if i+1 >= len(fields) {
+		return ""
+	}
+	switch v := fields[i+1].(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fields[i+1]
+}
+
+func writeJson(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+// 包含空格、引号或换行的值加引号
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// 标准库log的输出转为指定级别的日志，用于第三方库及http.Server等
+func Writer(l Level) io.Writer {
+	return levelWriter(l)
+}
+
+type levelWriter Level
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	write(Level(w), strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
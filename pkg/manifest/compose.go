@@ -0,0 +1,35 @@
+package manifest
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// 查找docker-compose文件中各服务的image字段
+// 兼容无services的v1格式，此时顶层key即为服务名称
+func ComposeImages(data []byte) ([]*ImageField, error) {
+	docs, err := decodeDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := []*ImageField{}
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		services := mappingValue(root, "services")
+		if services == nil {
+			services = root
+		}
+		if services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			name := services.Content[i].Value
+			if field := imageField("services."+name+".image", mappingValue(services.Content[i+1], "image")); field != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"strings"
+)
+
+// 镜像地址拆分结果，例：repository.xxx.com:8001/moebius/release/website:v1.9-10
+type ImageRef struct {
+	Domain     string // 镜像仓库域名，可为空
+	Repository string // 镜像名称，不含域名和tag
+	Tag        string
+	Digest     string
+}
+
+// 拆分镜像地址，第一段包含.或:或为localhost时视为域名
+func ParseImageRef(ref string) *ImageRef {
+	r := &ImageRef{}
+	if i := strings.Index(ref, "@"); i >= 0 {
+		r.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i >= 0 && !strings.Contains(ref[i+1:], "/") {
+		r.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.Index(ref, "/"); i >= 0 {
+		first := ref[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			r.Domain = first
+			ref = ref[i+1:]
+		}
+	}
+	r.Repository = ref
+	return r
+}
+
+// 不含tag和digest的镜像名称
+func (r *ImageRef) Name() string {
+	if r.Domain == "" {
+		return r.Repository
+	}
+	return r.Domain + "/" + r.Repository
+}
+
+func (r *ImageRef) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
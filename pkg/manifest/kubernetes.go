@@ -0,0 +1,47 @@
+package manifest
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// 查找kubernetes yaml中containers/initContainers下的image字段，支持多文档
+func ContainerImages(data []byte) ([]*ImageField, error) {
+	docs, err := decodeDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := []*ImageField{}
+	for i, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		fields = walkContainers(fmt.Sprintf("[%d]", i), doc.Content[0], fields)
+	}
+	return fields, nil
+}
+
+func walkContainers(path string, node *yaml.Node, fields []*ImageField) []*ImageField {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			keyPath := path + "." + key
+			if (key == "containers" || key == "initContainers") && value.Kind == yaml.SequenceNode {
+				for j, container := range value.Content {
+					field := imageField(fmt.Sprintf("%s[%d].image", keyPath, j), mappingValue(container, "image"))
+					if field != nil {
+						fields = append(fields, field)
+					}
+				}
+				continue
+			}
+			fields = walkContainers(keyPath, value, fields)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			fields = walkContainers(fmt.Sprintf("%s[%d]", path, i), item, fields)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,152 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 模板中的镜像占位符
+const ImagePlaceholder = "{{image}}"
+
+// 解析前替换占位符，{{image}}在yaml中会被解析为flow mapping
+const placeholderValue = "IMAGE_PLACEHOLDER"
+
+// 模板检查错误
+type LintError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// 模板中定义的kubernetes资源
+type Resource struct {
+	File       string
+	Line       int
+	ApiVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+// 资源唯一标识 kind/namespace/name
+func (r *Resource) Key() string {
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+var yamlErrorLineRegexp = regexp.MustCompile(`line (\d+):`)
+
+// 检查模板文件：多文档yaml语法、{{image}}占位符、apiVersion/kind/metadata.name
+func LintTemplate(file string, data []byte) ([]*Resource, []*LintError) {
+	errs := []*LintError{}
+	if !bytes.Contains(data, []byte(ImagePlaceholder)) {
+		errs = append(errs, &LintError{File: file, Line: 1, Message: i18n.T("模板缺少%s占位符", ImagePlaceholder)})
+	}
+
+	data = bytes.Replace(data, []byte(ImagePlaceholder), []byte(placeholderValue), -1)
+	docs, err := decodeDocuments(data)
+	if err != nil {
+		line := 0
+		if m := yamlErrorLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		errs = append(errs, &LintError{File: file, Line: line, Message: i18n.T("yaml格式错误：%s", strings.TrimPrefix(err.Error(), "yaml: "))})
+		return nil, errs
+	}
+
+	resources := []*Resource{}
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+			continue
+		}
+		if root.Kind != yaml.MappingNode {
+			errs = append(errs, &LintError{File: file, Line: root.Line, Message: i18n.T("yaml文档不是kubernetes资源对象")})
+			continue
+		}
+		r := &Resource{File: file, Line: root.Line}
+		missing := false
+		for _, key := range []string{"apiVersion", "kind"} {
+			v := mappingValue(root, key)
+			if v == nil || v.Kind != yaml.ScalarNode || v.Value == "" {
+				errs = append(errs, &LintError{File: file, Line: root.Line, Message: i18n.T("资源缺少%s", key)})
+				missing = true
+				continue
+			}
+			if key == "apiVersion" {
+				r.ApiVersion = v.Value
+			} else {
+				r.Kind = v.Value
+			}
+		}
+		metadata := mappingValue(root, "metadata")
+		name := mappingValue(metadata, "name")
+		if name == nil || name.Kind != yaml.ScalarNode || name.Value == "" {
+			line := root.Line
+			if metadata != nil {
+				line = metadata.Line
+			}
+			errs = append(errs, &LintError{File: file, Line: line, Message: i18n.T("资源缺少%s", "metadata.name")})
+			missing = true
+		} else {
+			r.Name = name.Value
+			r.Line = name.Line
+		}
+		if namespace := mappingValue(metadata, "namespace"); namespace != nil {
+			r.Namespace = namespace.Value
+		}
+		if !missing {
+			resources = append(resources, r)
+		}
+	}
+	return resources, errs
+}
+
+// 检查多个模板中是否存在重复的资源名称
+func DuplicateResources(resources []*Resource) []*LintError {
+	errs := []*LintError{}
+	seen := map[string]*Resource{}
+	for _, r := range resources {
+		if first, ok := seen[r.Key()]; ok {
+			errs = append(errs, &LintError{
+				File:    r.File,
+				Line:    r.Line,
+				Message: i18n.T("资源%s %s重复定义，首次定义于%s:%d", r.Kind, r.Name, first.File, first.Line),
+			})
+			continue
+		}
+		seen[r.Key()] = r
+	}
+	return errs
+}
+
+// 检查不同目录下是否存在同名模板，模板文件名即组件名称，同名时只有一个会被生成
+func DuplicateComponents(paths []string) []*LintError {
+	errs := []*LintError{}
+	seen := map[string]string{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		if first, ok := seen[name]; ok {
+			errs = append(errs, &LintError{
+				File:    path,
+				Line:    1,
+				Message: i18n.T("组件%s重复定义，首次定义于%s", name, first),
+			})
+			continue
+		}
+		seen[name] = path
+	}
+	return errs
+}
@@ -0,0 +1,83 @@
+package manifest
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// yaml文件中的image字段
+type ImageField struct {
+	Path   string // 字段位置，例：services.website.image
+	Line   int    // 行号，从1开始
+	Column int    // 列号，从1开始
+	Value  string // 镜像地址
+}
+
+// 解析多文档yaml
+func decodeDocuments(data []byte) ([]*yaml.Node, error) {
+	docs := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := dec.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// mapping节点中查找指定key的值
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func imageField(path string, node *yaml.Node) *ImageField {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Value == "" {
+		return nil
+	}
+	return &ImageField{Path: path, Line: node.Line, Column: node.Column, Value: node.Value}
+}
+
+// 替换image字段的值，仅修改对应位置的文本，其余内容及注释保持不变
+func ReplaceImages(data []byte, fields []*ImageField, images []string) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, field := range fields {
+		if field.Line < 1 || field.Line > len(lines) {
+			continue
+		}
+		line := lines[field.Line-1]
+		// yaml列号按字符计算，转换为字节偏移
+		offset := 0
+		for col := 1; col < field.Column && offset < len(line); col++ {
+			_, size := utf8.DecodeRuneInString(line[offset:])
+			offset += size
+		}
+		if offset < len(line) && (line[offset] == '"' || line[offset] == '\'') {
+			offset++
+		}
+		if !strings.HasPrefix(line[offset:], field.Value) {
+			offset = strings.Index(line, field.Value)
+			if offset < 0 {
+				continue
+			}
+		}
+		lines[field.Line-1] = line[:offset] + images[i] + line[offset+len(field.Value):]
+	}
+	return []byte(strings.Join(lines, ""))
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	RegistryRequests = NewCounterVec("app_registry_requests_total",
+		"镜像仓库请求次数，code为http状态码，请求未完成时为error", "backend", "endpoint", "code")
+	RegistryRequestDuration = NewHistogramVec("app_registry_request_duration_seconds",
+		"镜像仓库请求耗时", DefBuckets, "backend", "endpoint")
+	RegistryRequestErrors = NewCounterVec("app_registry_request_errors_total",
+		"镜像仓库请求失败次数，包括请求未完成与5xx", "backend", "endpoint")
+
+	Releases = NewCounterVec("app_release_total",
+		"release生成次数，result为success/failure", "format", "result")
+	ReleaseDuration = NewHistogramVec("app_release_duration_seconds",
+		"release生成耗时", []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600}, "format")
+	// 版本来自请求参数，不作为标签，避免任意版本号产生无限的时间序列
+	ReleaseImages = NewGaugeVec("app_release_images",
+		"最近一次成功生成的release中的镜像数量")
+	ReleaseLastSuccess = NewGaugeVec("app_release_last_success_timestamp_seconds",
+		"最近一次成功生成release的时间")
+)
+
+// 记录一次镜像仓库请求
+func ObserveRequest(backend, endpoint string, resp *http.Response, err error, duration time.Duration) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	RegistryRequests.Inc(backend, endpoint, code)
+	RegistryRequestDuration.Observe(duration.Seconds(), backend, endpoint)
+	if err != nil || resp.StatusCode >= 500 {
+		RegistryRequestErrors.Inc(backend, endpoint)
+	}
+}
+
+// 一次release生成，Done只记录第一次调用
+type ReleaseRun struct {
+	format string
+	start  time.Time
+	once   sync.Once
+}
+
+func StartRelease(format string) *ReleaseRun {
+	if format == "" {
+		format = "raw"
+	}
+	return &ReleaseRun{format: format, start: time.Now()}
+}
+
+// 记录release结果，images为生成的镜像数量，r为nil时不做任何处理
+func (r *ReleaseRun) Done(images int, err error) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		ReleaseDuration.Observe(time.Since(r.start).Seconds(), r.format)
+		if err != nil {
+			Releases.Inc(r.format, "failure")
+			return
+		}
+		Releases.Inc(r.format, "success")
+		ReleaseImages.Set(float64(images))
+		ReleaseLastSuccess.Set(float64(time.Now().Unix()))
+	})
+}
@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 极简的prometheus文本格式指标，只支持counter、gauge与histogram
+
+type metric interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+var (
+	mu      sync.Mutex
+	metrics []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	metrics = append(metrics, m)
+}
+
+// 默认histogram区间，单位秒
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	keys   map[string][]string // 标签值拼接 -> 标签值
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{name: name, help: help, kind: kind, labels: labels, keys: map[string][]string{}}
+}
+
+func (v *vec) metricName() string {
+	return v.name
+}
+
+// 调用方持有v.mu
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("指标%s标签数量不正确", v.name))
+	}
+	k := strings.Join(values, "\xff")
+	if _, ok := v.keys[k]; !ok {
+		v.keys[k] = append([]string{}, values...)
+	}
+	return k
+}
+
+// 按标签值排序，输出稳定
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.keys))
+	for k := range v.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, helpEscaper.Replace(v.help), v.name, v.kind)
+}
+
+func labelString(names, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// HELP中只转义\与换行
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels), values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(values)] += delta
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels, c.keys[k]), formatFloat(c.values[k]))
+	}
+}
+
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, "gauge", labels), values: map[string]float64{}}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(values)] = value
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	for _, k := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelString(g.labels, g.keys[k]), formatFloat(g.values[k]))
+	}
+}
+
+type histogram struct {
+	counts []uint64 // 与buckets对应，非累计
+	count  uint64
+	sum    float64
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+	values  map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets, values: map[string]*histogram{}}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := h.key(values)
+	o, ok := h.values[k]
+	if !ok {
+		o = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = o
+	}
+	for i, b := range h.buckets {
+		if value <= b {
+			o.counts[i]++
+			break
+		}
+	}
+	o.count++
+	o.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, k := range h.sortedKeys() {
+		o := h.values[k]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += o.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, h.keys[k], "le", formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, h.keys[k], "le", "+Inf"), o.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, h.keys[k]), formatFloat(o.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, h.keys[k]), o.count)
+	}
+}
+
+// 以prometheus文本格式输出所有指标
+func Write(w io.Writer) error {
+	mu.Lock()
+	all := append([]metric{}, metrics...)
+	mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].metricName() < all[j].metricName() })
+	bw := bufio.NewWriter(w)
+	for _, m := range all {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// 写入node_exporter textfile collector文件，先写临时文件再重命名，避免被读取到一半
+func WriteFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".metrics")
+	if err != nil {
+		return err
+	}
+	if err := Write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// /metrics 接口
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w)
+	})
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func output(m metric) string {
+	var buf bytes.Buffer
+	m.write(&buf)
+	return buf.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "请求次数\n第二行\\", "backend", "code")
+	c.Inc("registry", "200")
+	c.Add(2, "registry", "200")
+	c.Inc("harbor", `a"b\c`+"\n")
+	want := `# HELP test_requests_total 请求次数\n第二行\\
+# TYPE test_requests_total counter
+test_requests_total{backend="harbor",code="a\"b\\c\n"} 1
+test_requests_total{backend="registry",code="200"} 3
+`
+	if got := output(c); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeWithoutLabels(t *testing.T) {
+	g := NewGaugeVec("test_images", "镜像数量")
+	if got := output(g); got != "# HELP test_images 镜像数量\n# TYPE test_images gauge\n" {
+		t.Fatalf("a gauge without samples should only write its header, got\n%s", got)
+	}
+	g.Set(3)
+	g.Set(5)
+	if got := output(g); !strings.HasSuffix(got, "\ntest_images 5\n") {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "耗时", []float64{0.1, 1}, "endpoint")
+	h.Observe(0.05, "tags")
+	h.Observe(0.5, "tags")
+	h.Observe(0.1, "tags")
+	h.Observe(3, "tags")
+	want := `# HELP test_duration_seconds 耗时
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{endpoint="tags",le="0.1"} 2
+test_duration_seconds_bucket{endpoint="tags",le="1"} 3
+test_duration_seconds_bucket{endpoint="tags",le="+Inf"} 4
+test_duration_seconds_sum{endpoint="tags"} 3.65
+test_duration_seconds_count{endpoint="tags"} 4
+`
+	if got := output(h); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewCounterVec("test_panics_total", "标签数量", "backend")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	c.Inc("registry", "200")
+}
+
+func TestReleaseRun(t *testing.T) {
+	run := StartRelease("")
+	run.Done(4, nil)
+	// 只记录第一次调用
+	run.Done(0, errors.New("failed"))
+	StartRelease("helm").Done(0, errors.New("failed"))
+
+	if got := output(Releases); !strings.Contains(got, `app_release_total{format="raw",result="success"} 1`) ||
+		!strings.Contains(got, `app_release_total{format="helm",result="failure"} 1`) ||
+		strings.Contains(got, `format="raw",result="failure"`) {
+		t.Fatalf("got\n%s", got)
+	}
+	if got := output(ReleaseImages); !strings.HasSuffix(got, "\napp_release_images 4\n") {
+		t.Fatalf("got\n%s", got)
+	}
+	(*ReleaseRun)(nil).Done(1, nil)
+}
+
+func TestHandler(t *testing.T) {
+	ObserveRequest("registry", "tags", &http.Response{StatusCode: 503}, nil, 20*time.Millisecond)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		`app_registry_requests_total{backend="registry",endpoint="tags",code="503"} 1`,
+		`app_registry_request_errors_total{backend="registry",endpoint="tags"} 1`,
+		`app_registry_request_duration_seconds_bucket{backend="registry",endpoint="tags",le="0.025"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, body)
+		}
+	}
+	// 指标按名称排序输出
+	if strings.Index(body, "# HELP app_registry_request_duration_seconds") > strings.Index(body, "# HELP app_registry_requests_total") {
+		t.Fatal("metrics are not sorted by name")
+	}
+}
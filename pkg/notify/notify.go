@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 签名请求头，值为 sha256=hex(hmac_sha256(secret, body))
+const SignatureHeader = "X-Signature-256"
+
+// 通知配置文件
+type Config struct {
+	Webhooks []*Webhook `yaml:"webhooks"`
+}
+
+type Webhook struct {
+	Url      string            `yaml:"url"`
+	Events   []string          `yaml:"events"`  // 订阅的事件，为空时订阅所有事件
+	Payload  string            `yaml:"payload"` // go模板，为空时发送事件json
+	Secret   string            `yaml:"secret"`  // HMAC签名密钥，为空时不签名
+	Headers  map[string]string `yaml:"headers"`
+	Retries  int               `yaml:"retries"`  // 失败重试次数，默认3
+	Timeout  time.Duration     `yaml:"timeout"`  // 单次请求超时，默认10s
+	Insecure bool              `yaml:"insecure"` // 跳过证书校验，只用于自签名证书的内部地址
+
+	payload *template.Template
+}
+
+type Notifier struct {
+	webhooks []*Webhook
+	client   *http.Client
+	insecure *http.Client // insecure为true的webhook使用
+}
+
+// 重试间隔，按1s、2s、4s...递增
+var retryDelay = time.Second
+
+var templateFuncs = template.FuncMap{
+	// 输出json编码后的值，用于在json payload中安全嵌入字符串
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// 读取通知配置文件
+func LoadConfig(path string) (*Notifier, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+func New(config *Config) (*Notifier, error) {
+	for i, w := range config.Webhooks {
+		if w.Url == "" {
+			return nil, fmt.Errorf(i18n.T("第%d个webhook未配置url"), i+1)
+		}
+		if w.Payload != "" {
+			t, err := template.New(w.Url).Funcs(templateFuncs).Parse(w.Payload)
+			if err != nil {
+				return nil, fmt.Errorf(i18n.T("webhook payload模板错误：%s %w"), w.Url, err)
+			}
+			w.payload = t
+		}
+		if w.Retries <= 0 {
+			w.Retries = 3
+		}
+		if w.Timeout <= 0 {
+			w.Timeout = 10 * time.Second
+		}
+	}
+	insecure := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return &Notifier{
+		webhooks: config.Webhooks,
+		client:   &http.Client{},
+		insecure: &http.Client{Transport: insecure},
+	}, nil
+}
+
+// 发送事件到所有订阅该事件的webhook，通知失败只记录日志并返回错误，不影响调用方流程
+// ctx取消时停止等待重试并返回
+func (n *Notifier) Send(ctx context.Context, event *models.NotifyEvent) error {
+	if n == nil {
+		return nil
+	}
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339)
+	}
+	failed := []string{}
+	for _, w := range n.webhooks {
+		if !w.subscribed(event.Type) {
+			continue
+		}
+		if err := n.post(ctx, w, event); err != nil {
+			logger.Warn(i18n.T("发送通知失败"), "url", w.Url, "error", err)
+			failed = append(failed, w.Url)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(i18n.T("发送通知失败：%s", strings.Join(failed, ",")))
+	}
+	return nil
+}
+
+func (w *Webhook) subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) render(event *models.NotifyEvent) ([]byte, error) {
+	if w.payload == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := w.payload.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 发送请求，网络错误、5xx或429时按1s、2s、4s...间隔重试，其他4xx不重试
+func (n *Notifier) post(ctx context.Context, w *Webhook, event *models.NotifyEvent) error {
+	body, err := w.render(event)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := n.postOnce(ctx, w, event.Type, body)
+		if err == nil || !retry || attempt >= w.Retries || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(retryDelay << uint(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// 发送一次请求，返回失败时是否可以重试
+func (n *Notifier) postOnce(ctx context.Context, w *Webhook, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", eventType)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body))
+	}
+	client := *n.client
+	if w.Insecure {
+		client = *n.insecure
+	}
+	client.Timeout = w.Timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return false, nil
+}
+
+// 计算HMAC-SHA256签名
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 本地webhook接收端，前failures次请求返回status，默认500
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(failures int, tls bool) *receiver {
+	r := &receiver{failures: failures, status: http.StatusInternalServerError}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		if len(r.requests) <= r.failures {
+			http.Error(w, "unavailable", r.status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if tls {
+		r.Server = httptest.NewTLSServer(handler)
+	} else {
+		r.Server = httptest.NewServer(handler)
+	}
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	r := newReceiver(0, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Secret: "s3cret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &models.NotifyEvent{Type: "release-generated", Version: "v1.9"}
+	if err := n.Send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 1 {
+		t.Fatalf("got %d requests, want 1", r.count())
+	}
+	req, body := r.requests[0], r.bodies[0]
+	if got, want := req.Header.Get(SignatureHeader), "sha256="+Sign("s3cret", body); got != want {
+		t.Fatalf("signature %q, want %q", got, want)
+	}
+	if req.Header.Get("X-Event-Type") != "release-generated" {
+		t.Fatalf("event type header %q", req.Header.Get("X-Event-Type"))
+	}
+	var got models.NotifyEvent
+	if err := json.Unmarshal(body, &got); err != nil || got.Version != "v1.9" {
+		t.Fatalf("body %s: %v", body, err)
+	}
+}
+
+func TestSendWithoutSecretIsUnsigned(t *testing.T) {
+	r := newReceiver(0, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "image-pushed"}); err != nil {
+		t.Fatal(err)
+	}
+	if sig := r.requests[0].Header.Get(SignatureHeader); sig != "" {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	r := newReceiver(2, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Secret: "s3cret", Retries: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 3 {
+		t.Fatalf("got %d requests, want 3", r.count())
+	}
+	// 重试时发送相同内容与签名
+	for i := 1; i < r.count(); i++ {
+		if string(r.bodies[i]) != string(r.bodies[0]) || r.requests[i].Header.Get(SignatureHeader) != r.requests[0].Header.Get(SignatureHeader) {
+			t.Fatalf("request %d differs from the first request", i)
+		}
+	}
+}
+
+func TestSendGivesUpAfterRetries(t *testing.T) {
+	r := newReceiver(10, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Retries: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if r.count() != 3 {
+		t.Fatalf("got %d requests, want 3", r.count())
+	}
+}
+
+func TestSendSkipsUnsubscribed(t *testing.T) {
+	r := newReceiver(0, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Events: []string{"apply-failed"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 0 {
+		t.Fatalf("got %d requests, want 0", r.count())
+	}
+}
+
+func TestSendVerifiesCertificates(t *testing.T) {
+	r := newReceiver(0, true)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Retries: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err == nil {
+		t.Fatal("expected a certificate error for a self-signed receiver")
+	}
+	if r.count() != 0 {
+		t.Fatalf("got %d requests, want 0", r.count())
+	}
+
+	n, err = New(&Config{Webhooks: []*Webhook{{Url: r.URL, Insecure: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendRetryStatus(t *testing.T) {
+	for status, want := range map[int]int{
+		http.StatusBadGateway:      3,
+		http.StatusTooManyRequests: 3,
+		// 其他4xx重试也不会成功
+		http.StatusBadRequest:   1,
+		http.StatusUnauthorized: 1,
+		http.StatusNotFound:     1,
+	} {
+		r := newReceiver(10, false)
+		r.status = status
+		n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Retries: 2}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Send(context.Background(), &models.NotifyEvent{Type: "release-generated"}); err == nil {
+			t.Fatalf("status %d: expected an error", status)
+		}
+		if r.count() != want {
+			t.Errorf("status %d: got %d requests, want %d", status, r.count(), want)
+		}
+		r.Close()
+	}
+}
+
+func TestSendStopsRetryingWhenCanceled(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Hour
+	r := newReceiver(10, false)
+	defer r.Close()
+	n, err := New(&Config{Webhooks: []*Webhook{{Url: r.URL, Retries: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for r.count() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	done := make(chan error, 1)
+	go func() { done <- n.Send(ctx, &models.NotifyEvent{Type: "release-generated"}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send kept waiting for the retry delay after cancellation")
+	}
+	if r.count() != 1 {
+		t.Fatalf("got %d requests, want 1", r.count())
+	}
+}
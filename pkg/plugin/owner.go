@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package plugin
+
+import (
+	"os"
+	"syscall"
+)
+
+// 文件属主是否为当前用户
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
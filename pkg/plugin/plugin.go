@@ -0,0 +1,317 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 已安装插件记录文件名，位于插件安装目录下
+const StateFile = "plugins.json"
+
+var ErrChecksum = i18n.NewError("插件安装包sha256校验失败")
+
+var ErrNoChecksum = i18n.NewError("插件列表未提供sha256，需指定--allow-unverified才能安装")
+
+var ErrNotOwner = i18n.NewError("插件安装目录不属于当前用户")
+
+// 插件安装目录，每个插件解压到 Dir/<插件名称>/<版本>，已安装插件记录在 Dir/plugins.json
+// AllowUnverified为true时允许安装插件列表未提供sha256的插件
+type Manager struct {
+	Dir             string
+	AllowUnverified bool
+}
+
+func New(dir string) *Manager {
+	return &Manager{Dir: dir}
+}
+
+// 默认插件安装目录，用户主目录下的.app/plugins
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".app", "plugins"), nil
+}
+
+// 检查安装目录属于当前用户，不存在且create为true时以0700创建
+// 其他用户可写入的目录中的插件与记录文件不可信，拒绝使用
+func (m *Manager) checkDir(create bool) error {
+	info, err := os.Stat(m.Dir)
+	if os.IsNotExist(err) && create {
+		if err := os.MkdirAll(m.Dir, 0700); err != nil {
+			return err
+		}
+		info, err = os.Stat(m.Dir)
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(i18n.T("插件安装目录不是目录：%s", m.Dir))
+	}
+	if !ownedByCurrentUser(info) {
+		return fmt.Errorf(i18n.T("%w：%s"), ErrNotOwner, m.Dir)
+	}
+	return nil
+}
+
+func (m *Manager) statePath() string {
+	return filepath.Join(m.Dir, StateFile)
+}
+
+// 读取已安装插件，记录文件不存在时返回空列表
+func (m *Manager) Installed() (*models.Plugins, error) {
+	if err := m.checkDir(false); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(m.statePath())
+	if os.IsNotExist(err) {
+		return &models.Plugins{Plugins: []*models.Plugin{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &models.Plugins{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf(i18n.T("解析插件记录文件失败：%w"), err)
+	}
+	return state, nil
+}
+
+// 已安装的插件，未安装时返回nil
+func (m *Manager) Get(name string) (*models.Plugin, error) {
+	state, err := m.Installed()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range state.Plugins {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// 记录已安装插件，先写临时文件再重命名
+func (m *Manager) save(plugin *models.Plugin) error {
+	state, err := m.Installed()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, p := range state.Plugins {
+		if p.Name == plugin.Name {
+			state.Plugins[i] = plugin
+			replaced = true
+		}
+	}
+	if !replaced {
+		state.Plugins = append(state.Plugins, plugin)
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(m.Dir, "."+StateFile+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.statePath())
+}
+
+// 插件名称与版本用作目录名，不能包含路径分隔符
+func checkName(s string) error {
+	if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\`) {
+		return errors.New(i18n.T("插件名称或版本不正确：%s", s))
+	}
+	return nil
+}
+
+// 插件列表未提供sha256且未允许时返回ErrNoChecksum，安装多个插件前先检查，避免只安装了一部分
+func (m *Manager) CheckVerifiable(detail *models.PluginDetail, version *models.PluginVersion) error {
+	if version.Sha256 == "" && !m.AllowUnverified {
+		return fmt.Errorf(i18n.T("%w：%s"), ErrNoChecksum, detail.Name+"@"+version.Version)
+	}
+	return nil
+}
+
+// 下载插件并校验sha256，tar.gz/zip解压到安装目录，其他文件直接放入安装目录
+// 已安装相同版本且force为false时不重新安装；安装成功后删除该插件的旧版本目录
+func (m *Manager) Install(ctx context.Context, detail *models.PluginDetail, version *models.PluginVersion, force bool) (*models.Plugin, error) {
+	if err := checkName(detail.Name); err != nil {
+		return nil, err
+	}
+	if err := checkName(version.Version); err != nil {
+		return nil, err
+	}
+	if err := m.checkDir(true); err != nil {
+		return nil, err
+	}
+	installed, err := m.Get(detail.Name)
+	if err != nil {
+		return nil, err
+	}
+	if installed != nil && installed.Version == version.Version && !force {
+		logger.Info(i18n.T("插件已安装"), "plugin", detail.Name, "version", version.Version, "dir", installed.Dir)
+		return installed, nil
+	}
+
+	if err := m.CheckVerifiable(detail, version); err != nil {
+		return nil, err
+	}
+
+	pluginDir := filepath.Join(m.Dir, detail.Name)
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return nil, err
+	}
+	archive, sum, err := download(ctx, pluginDir, version.DownloadUrl)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("下载插件失败：%w"), err)
+	}
+	defer os.Remove(archive)
+	if version.Sha256 == "" {
+		logger.Warn(i18n.T("插件列表未提供sha256，已指定--allow-unverified，跳过校验"), "plugin", detail.Name, "version", version.Version)
+	} else if expected := strings.ToLower(strings.TrimPrefix(version.Sha256, "sha256:")); expected != sum {
+		return nil, fmt.Errorf(i18n.T("%w：%s 实际为%s，应为%s"), ErrChecksum, detail.Name, sum, expected)
+	}
+
+	// 先解压到临时目录，完成后替换安装目录
+	staging, err := ioutil.TempDir(pluginDir, "."+version.Version+".")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, err
+	}
+	if err := unpack(archive, version.DownloadUrl, staging); err != nil {
+		return nil, fmt.Errorf(i18n.T("解压插件失败：%w"), err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(pluginDir, version.Version)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		return nil, err
+	}
+
+	plugin := &models.Plugin{
+		Name:        detail.Name,
+		Description: detail.Description,
+		Version:     version.Version,
+		Dir:         dir,
+		DownloadUrl: version.DownloadUrl,
+		Sha256:      sum,
+		InstallTime: time.Now().Format(time.RFC3339),
+	}
+	if installed != nil {
+		plugin.InstallLogFile = installed.InstallLogFile
+	}
+	if err := m.save(plugin); err != nil {
+		return nil, fmt.Errorf(i18n.T("写入插件记录文件失败：%w"), err)
+	}
+	// 只删除该插件目录下的旧版本，记录文件中的目录不可信
+	if installed != nil && installed.Dir != dir && filepath.Dir(filepath.Clean(installed.Dir)) == pluginDir {
+		if err := os.RemoveAll(installed.Dir); err != nil {
+			logger.Warn(i18n.T("删除插件旧版本失败"), "dir", installed.Dir, "error", err)
+		}
+	}
+	logger.Info(i18n.T("插件安装完成"), "plugin", plugin.Name, "version", plugin.Version, "dir", dir)
+	return plugin, nil
+}
+
+// 下载到dir下的临时文件，返回文件路径与sha256
+func download(ctx context.Context, dir, downloadUrl string) (string, string, error) {
+	if downloadUrl == "" {
+		return "", "", errors.New(i18n.T("插件下载地址为空"))
+	}
+	f, err := ioutil.TempFile(dir, ".download.")
+	if err != nil {
+		return "", "", err
+	}
+	logger.Info(i18n.T("下载插件"), "url", downloadUrl)
+	h := sha256.New()
+	err = repository.Download(ctx, downloadUrl, io.MultiWriter(f, h))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 按下载地址后缀或文件头判断格式
+func unpack(archive, downloadUrl, dir string) error {
+	name := downloadUrl
+	if u, err := url.Parse(downloadUrl); err == nil {
+		name = u.Path
+	}
+	name = path.Base(name)
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip") || strings.HasPrefix(string(magic), "PK\x03\x04"):
+		return utils.ExtractZip(archive, dir)
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasPrefix(string(magic), "\x1f\x8b"):
+		return utils.ExtractTarGz(f, dir)
+	}
+	if err := checkName(name); err != nil {
+		name = "plugin"
+	}
+	dst, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, f); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
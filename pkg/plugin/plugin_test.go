@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 插件下载服务，/<版本>.tgz返回只包含bin/run文件的安装包，记录各版本下载次数
+type archiveServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	downloads map[string]int
+	archives  map[string][]byte
+}
+
+func newArchiveServer(t *testing.T, versions ...string) *archiveServer {
+	s := &archiveServer{downloads: map[string]int{}, archives: map[string][]byte{}}
+	for _, version := range versions {
+		s.archives[version] = tgz(t, "bin/run", "#!/bin/sh\necho "+version+"\n")
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".tgz")
+		s.mu.Lock()
+		s.downloads[version]++
+		s.mu.Unlock()
+		b, ok := s.archives[version]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	return s
+}
+
+func (s *archiveServer) count(version string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads[version]
+}
+
+func (s *archiveServer) version(version string) *models.PluginVersion {
+	sum := sha256.Sum256(s.archives[version])
+	return &models.PluginVersion{Version: version, DownloadUrl: s.URL + "/" + version + ".tgz", Sha256: "sha256:" + hex.EncodeToString(sum[:])}
+}
+
+func tgz(t *testing.T, name, content string) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestManager(t *testing.T) *Manager {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(filepath.Join(dir, "plugins"))
+}
+
+func TestInstall(t *testing.T) {
+	srv := newArchiveServer(t, "1.0.0-1_x86", "1.1.0-1_x86")
+	defer srv.Close()
+	m := newTestManager(t)
+	defer os.RemoveAll(filepath.Dir(m.Dir))
+	detail := &models.PluginDetail{Name: "mysql"}
+	ctx := context.Background()
+
+	installed, err := m.Install(ctx, detail, srv.version("1.0.0-1_x86"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir := filepath.Join(m.Dir, "mysql", "1.0.0-1_x86")
+	if installed.Dir != oldDir {
+		t.Fatalf("got dir %s, want %s", installed.Dir, oldDir)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(oldDir, "bin", "run")); err != nil || !strings.Contains(string(b), "1.0.0-1_x86") {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	if info, err := os.Stat(m.Dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("install dir should be created 0700: %v, %v", info, err)
+	}
+
+	// 已安装相同版本时不重新下载，force时重新安装
+	if _, err := m.Install(ctx, detail, srv.version("1.0.0-1_x86"), false); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("1.0.0-1_x86"); n != 1 {
+		t.Fatalf("reinstall downloaded again, %d downloads", n)
+	}
+	if err := ioutil.WriteFile(filepath.Join(oldDir, "bin", "run"), []byte("modified"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Install(ctx, detail, srv.version("1.0.0-1_x86"), true); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("1.0.0-1_x86"); n != 2 {
+		t.Fatalf("force did not download again, %d downloads", n)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(oldDir, "bin", "run")); string(b) == "modified" {
+		t.Fatal("force did not replace the install dir")
+	}
+
+	// 升级后删除旧版本目录，记录文件只保留新版本
+	upgraded, err := m.Install(ctx, detail, srv.version("1.1.0-1_x86"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(oldDir); !os.IsNotExist(err) {
+		t.Fatalf("old version dir was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(upgraded.Dir, "bin", "run")); err != nil {
+		t.Fatal(err)
+	}
+	state, err := m.Installed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Plugins) != 1 || state.Plugins[0].Version != "1.1.0-1_x86" {
+		t.Fatalf("got %+v", state.Plugins)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(m.Dir, "mysql"))
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left in the plugin dir: %v", entries)
+	}
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	srv := newArchiveServer(t, "1.0.0-1_x86", "1.1.0-1_x86")
+	defer srv.Close()
+	m := newTestManager(t)
+	defer os.RemoveAll(filepath.Dir(m.Dir))
+	detail := &models.PluginDetail{Name: "mysql"}
+	ctx := context.Background()
+	if _, err := m.Install(ctx, detail, srv.version("1.0.0-1_x86"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// 校验失败时不安装，已安装版本与记录文件保持不变
+	version := srv.version("1.1.0-1_x86")
+	version.Sha256 = srv.version("1.0.0-1_x86").Sha256
+	if _, err := m.Install(ctx, detail, version, false); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("got %v, want ErrChecksum", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.Dir, "mysql", "1.1.0-1_x86")); !os.IsNotExist(err) {
+		t.Fatalf("a mismatched archive was installed: %v", err)
+	}
+	installed, err := m.Get("mysql")
+	if err != nil || installed == nil || installed.Version != "1.0.0-1_x86" {
+		t.Fatalf("got %+v, %v", installed, err)
+	}
+	if _, err := os.Stat(installed.Dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(m.Dir, "mysql"))
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left in the plugin dir: %v", entries)
+	}
+
+	// 未提供sha256时需AllowUnverified
+	version = srv.version("1.1.0-1_x86")
+	version.Sha256 = ""
+	if _, err := m.Install(ctx, detail, version, false); !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("got %v, want ErrNoChecksum", err)
+	}
+	m.AllowUnverified = true
+	if _, err := m.Install(ctx, detail, version, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstallRefusesForeignDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner requires root")
+	}
+	srv := newArchiveServer(t, "1.0.0-1_x86")
+	defer srv.Close()
+	m := newTestManager(t)
+	defer os.RemoveAll(filepath.Dir(m.Dir))
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(m.Dir, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Install(context.Background(), &models.PluginDetail{Name: "mysql"}, srv.version("1.0.0-1_x86"), false); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("got %v, want ErrNotOwner", err)
+	}
+	if _, err := m.Installed(); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("got %v, want ErrNotOwner", err)
+	}
+	if n := srv.count("1.0.0-1_x86"); n != 0 {
+		t.Fatalf("downloaded into a foreign dir, %d downloads", n)
+	}
+}
@@ -0,0 +1,19 @@
+package release
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/cache"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/notify"
+	"io"
+)
+
+// 镜像查询与release生成
+// Cache为nil时不缓存tag列表，Notifier为nil时不发送通知，Output为nil时apply命令输出到标准输出
+// PluginSources为配置文件中的插件列表来源，PluginCache为nil时不缓存插件列表
+type Client struct {
+	Cache         *cache.Cache
+	Notifier      *notify.Notifier
+	Output        io.Writer
+	PluginSources []*models.PluginSource
+	PluginCache   *cache.IndexCache
+}
@@ -0,0 +1,171 @@
+package release
+
+import (
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidConstraint = i18n.NewError("版本约束格式不正确")
+
+// 插件或平台版本，如 1.2.0-3_x86、v1.9、v1.9-10
+// 依次比较点分隔的各段、-后的编译序号，_后的后缀只用于=、!=
+type pluginVersion struct {
+	parts  []int
+	build  int
+	suffix string
+}
+
+func parsePluginVersion(s string) (*pluginVersion, error) {
+	v := &pluginVersion{}
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "V")
+	if i := strings.Index(s, "_"); i >= 0 {
+		s, v.suffix = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		build, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("版本号格式不正确：%s"), s)
+		}
+		s, v.build = s[:i], build
+	}
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("版本号格式不正确：%s"), s)
+		}
+		v.parts = append(v.parts, n)
+	}
+	return v, nil
+}
+
+// a<b返回-1，a=b返回0，a>b返回1，缺少的段按0比较
+func comparePluginVersion(a, b *pluginVersion) int {
+	for i := 0; i < len(a.parts) || i < len(b.parts); i++ {
+		x, y := 0, 0
+		if i < len(a.parts) {
+			x = a.parts[i]
+		}
+		if i < len(b.parts) {
+			y = b.parts[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a.build < b.build:
+		return -1
+	case a.build > b.build:
+		return 1
+	}
+	return 0
+}
+
+type constraintClause struct {
+	op      string
+	version *pluginVersion
+}
+
+// 版本约束，逗号分隔的多个条件需同时满足，如 >=1.2.0, <2.0
+// 支持 = == != > >= < <=，不带运算符时为=；为空、*或latest时不限制版本
+type Constraint struct {
+	raw     string
+	clauses []constraintClause
+}
+
+var constraintOps = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" || c.raw == "*" || c.raw == "latest" {
+		return c, nil
+	}
+	for _, clause := range strings.Split(c.raw, ",") {
+		clause = strings.TrimSpace(clause)
+		op := "="
+		for _, o := range constraintOps {
+			if strings.HasPrefix(clause, o) {
+				op, clause = o, strings.TrimSpace(clause[len(o):])
+				break
+			}
+		}
+		if op == "==" {
+			op = "="
+		}
+		v, err := parsePluginVersion(clause)
+		if clause == "" || err != nil {
+			return nil, fmt.Errorf(i18n.T("%w：%s"), ErrInvalidConstraint, s)
+		}
+		c.clauses = append(c.clauses, constraintClause{op: op, version: v})
+	}
+	return c, nil
+}
+
+// 版本是否满足约束，版本无法解析时只满足不限制版本的约束
+func (c *Constraint) Match(version string) bool {
+	if len(c.clauses) == 0 {
+		return true
+	}
+	v, err := parsePluginVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, clause := range c.clauses {
+		n := comparePluginVersion(v, clause.version)
+		equal := n == 0 && (clause.version.suffix == "" || clause.version.suffix == v.suffix)
+		var ok bool
+		switch clause.op {
+		case "=":
+			ok = equal
+		case "!=":
+			ok = !equal
+		case ">":
+			ok = n > 0
+		case ">=":
+			ok = n >= 0
+		case "<":
+			ok = n < 0
+		case "<=":
+			ok = n <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 约束中指定的版本后缀，如 =1.2.0-3_arm 为arm，未指定时返回空
+func (c *Constraint) Suffix() string {
+	for _, clause := range c.clauses {
+		if clause.version.suffix != "" {
+			return clause.version.suffix
+		}
+	}
+	return ""
+}
+
+func (c *Constraint) String() string {
+	if c.raw == "" {
+		return "*"
+	}
+	return c.raw
+}
+
+// 插件版本是否兼容平台版本，platform为空或未声明compatible时兼容
+func PluginCompatible(v *models.PluginVersion, platform string) (bool, error) {
+	if platform == "" || v.Compatible == "" {
+		return true, nil
+	}
+	c, err := ParseConstraint(v.Compatible)
+	if err != nil {
+		return false, err
+	}
+	return c.Match(platform), nil
+}
@@ -0,0 +1,250 @@
+package release
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidIndex = i18n.NewError("插件列表校验失败")
+
+// 插件安装包扩展名，生成插件列表时只处理这些文件
+var pluginArchiveExts = []string{".tar.gz", ".tgz", ".zip"}
+
+// 插件描述文件，<插件名称>.description，内容作为插件描述
+const pluginDescriptionExt = ".description"
+
+var sha256Pattern = regexp.MustCompile(`^(sha256:)?[0-9a-fA-F]{64}$`)
+
+// 按文件名 <插件名称>-<版本>.tar.gz 解析插件名称与版本，版本如 1.2.0-3_x86，插件名称可以包含-
+func ParsePluginFileName(file string) (string, string, bool) {
+	base := ""
+	for _, ext := range pluginArchiveExts {
+		if strings.HasSuffix(strings.ToLower(file), ext) {
+			base = file[:len(file)-len(ext)]
+			break
+		}
+	}
+	for i := 1; i < len(base)-1; i++ {
+		if base[i] != '-' || base[i+1] < '0' || base[i+1] > '9' {
+			continue
+		}
+		if _, err := parsePluginVersion(base[i+1:]); err == nil {
+			return base[:i], base[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// 读取目录下的插件安装包生成插件列表，下载地址为baseUrl加文件名
+// existing不为nil时在其基础上更新：保留已有版本的requires/compatible与插件描述，prune为true时删除目录中不存在安装包的版本
+func BuildPluginIndex(build *models.PluginIndexBuild, existing *models.PluginList) (*models.PluginList, error) {
+	files, err := ioutil.ReadDir(build.Dir)
+	if err != nil {
+		return nil, err
+	}
+	plugins := map[string]*models.PluginDetail{}
+	if existing != nil {
+		for _, pl := range existing.Plugins {
+			plugins[pl.Name] = pl
+		}
+	}
+	found := map[string]bool{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name, version, ok := ParsePluginFileName(f.Name())
+		if !ok {
+			if !strings.HasSuffix(f.Name(), pluginDescriptionExt) {
+				logger.Debug(i18n.T("跳过非插件安装包文件"), "file", f.Name())
+			}
+			continue
+		}
+		sum, err := fileSha256(filepath.Join(build.Dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pl, ok := plugins[name]
+		if !ok {
+			pl = &models.PluginDetail{Name: name}
+			plugins[name] = pl
+		}
+		v := findPluginVersion(pl.Versions, version)
+		if v == nil {
+			v = &models.PluginVersion{Version: version}
+			pl.Versions = append(pl.Versions, v)
+			logger.Info(i18n.T("新增插件版本"), "plugin", name, "version", version)
+		}
+		v.DownloadUrl = strings.TrimSuffix(build.BaseUrl, "/") + "/" + url.PathEscape(f.Name())
+		v.Sha256 = sum
+		found[name+"@"+version] = true
+	}
+
+	list := &models.PluginList{Plugins: []*models.PluginDetail{}}
+	for _, pl := range plugins {
+		if b, err := ioutil.ReadFile(filepath.Join(build.Dir, pl.Name+pluginDescriptionExt)); err == nil {
+			pl.Description = strings.TrimSpace(string(b))
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if build.Prune {
+			versions := pl.Versions[:0]
+			for _, v := range pl.Versions {
+				if found[pl.Name+"@"+v.Version] {
+					versions = append(versions, v)
+				} else {
+					logger.Info(i18n.T("删除插件版本"), "plugin", pl.Name, "version", v.Version)
+				}
+			}
+			pl.Versions = versions
+			if len(pl.Versions) == 0 {
+				continue
+			}
+		}
+		sortPluginVersions(pl.Versions)
+		list.Plugins = append(list.Plugins, pl)
+	}
+	sort.Slice(list.Plugins, func(i, j int) bool {
+		return list.Plugins[i].Name < list.Plugins[j].Name
+	})
+	return list, nil
+}
+
+func findPluginVersion(versions []*models.PluginVersion, version string) *models.PluginVersion {
+	for _, v := range versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// 旧版本在前，无法解析的版本在最后
+func sortPluginVersions(versions []*models.PluginVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, aerr := parsePluginVersion(versions[i].Version)
+		b, berr := parsePluginVersion(versions[j].Version)
+		if aerr != nil || berr != nil {
+			return aerr == nil && berr != nil
+		}
+		return comparePluginVersion(a, b) < 0
+	})
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 按插件列表格式校验json或yaml格式的插件列表，返回解析结果与所有不符合的地方
+// 不允许未定义的字段，name、versions、version、download-url必填
+// 插件名称与版本不能包含路径分隔符，同一插件的版本不能重复，版本需符合 1.2.0-3_x86 格式
+// download-url为http/https地址，sha256为64位十六进制(可带sha256:前缀)
+// requires引用的插件需在插件列表中，requires与compatible为正确的版本约束
+func ValidatePluginIndex(b []byte) (*models.PluginList, []string) {
+	b, err := repository.PluginIndexJson(b)
+	if err != nil {
+		return nil, []string{i18n.T("解析插件列表失败：%s", err)}
+	}
+	list := &models.PluginList{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(list); err != nil {
+		return nil, []string{i18n.T("解析插件列表失败：%s", err)}
+	}
+	problems := []string{}
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, path+": "+i18n.T(format, args...))
+	}
+	if list.Plugins == nil {
+		add("plugins", "缺少字段%s", "plugins")
+	}
+	names := map[string]bool{}
+	for _, pl := range list.Plugins {
+		names[pl.Name] = true
+	}
+	seen := map[string]bool{}
+	for i, pl := range list.Plugins {
+		path := fmt.Sprintf("plugins[%d]", i)
+		if pl.Name != "" {
+			path = pl.Name
+		}
+		switch {
+		case pl.Name == "":
+			add(path, "缺少字段%s", "name")
+		case pl.Name == "." || pl.Name == ".." || strings.ContainsAny(pl.Name, `/\ `):
+			add(path, "插件名称不正确")
+		case seen[pl.Name]:
+			add(path, "插件名称重复")
+		}
+		seen[pl.Name] = true
+		if len(pl.Versions) == 0 {
+			add(path, "缺少字段%s", "versions")
+		}
+		versions := map[string]bool{}
+		for j, v := range pl.Versions {
+			vpath := fmt.Sprintf("%s.versions[%d]", path, j)
+			if v.Version != "" {
+				vpath = path + "@" + v.Version
+			}
+			if v.Version == "" {
+				add(vpath, "缺少字段%s", "version")
+			} else if _, err := parsePluginVersion(v.Version); err != nil || strings.ContainsAny(v.Version, `/\ `) {
+				add(vpath, "版本号格式不正确：%s", v.Version)
+			} else if versions[v.Version] {
+				add(vpath, "插件版本重复")
+			}
+			versions[v.Version] = true
+			if v.DownloadUrl == "" {
+				add(vpath, "缺少字段%s", "download-url")
+			} else if u, err := url.Parse(v.DownloadUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(vpath, "下载地址不是http/https地址：%s", v.DownloadUrl)
+			}
+			if v.Sha256 != "" && !sha256Pattern.MatchString(v.Sha256) {
+				add(vpath, "sha256格式不正确：%s", v.Sha256)
+			}
+			if v.Compatible != "" {
+				if _, err := ParseConstraint(v.Compatible); err != nil {
+					add(vpath, "compatible不正确：%s", err)
+				}
+			}
+			deps := make([]string, 0, len(v.Requires))
+			for dep := range v.Requires {
+				deps = append(deps, dep)
+			}
+			sort.Strings(deps)
+			for _, dep := range deps {
+				if !names[dep] {
+					add(vpath, "依赖的插件%s不在插件列表中", dep)
+				}
+				if _, err := ParseConstraint(v.Requires[dep]); err != nil {
+					add(vpath, "requires不正确：%s", err)
+				}
+			}
+		}
+	}
+	return list, problems
+}
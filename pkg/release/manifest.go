@@ -0,0 +1,188 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/manifest"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compose与bump只更新匹配前缀的镜像，未指定前缀时会查询并替换mysql、redis等第三方镜像
+var ErrNoPrefix = i18n.NewError("必须指定镜像前缀--prefix，避免误更新第三方镜像")
+
+// 文件中一个镜像字段的变更
+type ImageUpdate struct {
+	File     string
+	Line     int
+	Path     string // 字段位置，例：services.website.image
+	OldImage string
+	NewImage string
+}
+
+// 按最新版本更新镜像tag，原镜像指定了digest时同步更新digest，否则digest会锁定旧镜像
+func updatedImage(ref *manifest.ImageRef, latest *models.ImageTags) string {
+	newRef := &manifest.ImageRef{Domain: ref.Domain, Repository: ref.Repository, Tag: latest.ImageTag}
+	if ref.Digest != "" {
+		newRef.Digest = latest.Digest
+	}
+	return newRef.String()
+}
+
+// 更新docker-compose文件中匹配前缀的服务镜像为最新版本，写入composeRequest.Output，返回变更的镜像
+// 没有变更且输出文件为原文件时不写入
+func (c *Client) UpdateCompose(ctx context.Context, composeRequest *models.Compose) ([]*ImageUpdate, error) {
+	if composeRequest.Prefix == "" {
+		return nil, ErrNoPrefix
+	}
+	if composeRequest.File == "" {
+		composeRequest.File = "docker-compose.yml"
+	}
+	if composeRequest.Output == "" {
+		composeRequest.Output = composeRequest.File
+	}
+	info, err := os.Stat(composeRequest.File)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("读取docker-compose文件失败：%w"), err)
+	}
+	b, err := ioutil.ReadFile(composeRequest.File)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("读取docker-compose文件失败：%w"), err)
+	}
+	fields, err := manifest.ComposeImages(b)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("解析docker-compose文件失败：%w"), err)
+	}
+
+	updates := []*ImageUpdate{}
+	updated := []*manifest.ImageField{}
+	images := []string{}
+	for _, field := range fields {
+		ref := manifest.ParseImageRef(field.Value)
+		if !strings.HasPrefix(ref.Name(), composeRequest.Prefix) && !strings.HasPrefix(ref.Repository, composeRequest.Prefix) {
+			continue
+		}
+		searchRequest := &models.Search{
+			Type:    composeRequest.Type,
+			Url:     composeRequest.Url,
+			Name:    ref.Repository,
+			Version: composeRequest.Version,
+		}
+		logger.Info(i18n.T("搜索该镜像所有tag"), "image", searchRequest.Name)
+		latest, err := c.Latest(ctx, searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("镜像查询失败：%s：%w"), searchRequest.Name, err)
+		}
+		if latest == nil {
+			logger.Warn(i18n.T("未查询到最新版本"), "service", field.Path)
+			continue
+		}
+		image := updatedImage(ref, latest)
+		if image == field.Value {
+			continue
+		}
+		updates = append(updates, &ImageUpdate{File: composeRequest.File, Line: field.Line, Path: field.Path, OldImage: field.Value, NewImage: image})
+		updated = append(updated, field)
+		images = append(images, image)
+	}
+
+	if len(updates) == 0 && composeRequest.Output == composeRequest.File {
+		return updates, nil
+	}
+	if err := ioutil.WriteFile(composeRequest.Output, manifest.ReplaceImages(b, updated, images), info.Mode()); err != nil {
+		return nil, fmt.Errorf(i18n.T("写入docker-compose文件失败：%w"), err)
+	}
+	return updates, nil
+}
+
+// 将kubernetes yaml中匹配前缀的容器镜像更新为最新版本，返回变更的镜像，DryRun时不写入文件
+func (c *Client) BumpManifests(ctx context.Context, bumpRequest *models.Bump) ([]*ImageUpdate, error) {
+	if bumpRequest.Prefix == "" {
+		return nil, ErrNoPrefix
+	}
+	if len(bumpRequest.Paths) == 0 {
+		bumpRequest.Paths = []string{"."}
+	}
+	files := []string{}
+	for _, p := range bumpRequest.Paths {
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if info == nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("遍历yaml文件失败：%w"), err)
+		}
+	}
+
+	// 同一镜像在多个文件中出现时只查询一次
+	latestTags := map[string]*models.ImageTags{}
+	updates := []*ImageUpdate{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return updates, err
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return updates, err
+		}
+		fields, err := manifest.ContainerImages(b)
+		if err != nil {
+			logger.Warn(i18n.T("解析yaml失败，已跳过"), "path", file, "error", err)
+			continue
+		}
+
+		fileUpdates := []*ImageUpdate{}
+		updated := []*manifest.ImageField{}
+		images := []string{}
+		for _, field := range fields {
+			ref := manifest.ParseImageRef(field.Value)
+			if !strings.HasPrefix(ref.Name(), bumpRequest.Prefix) && !strings.HasPrefix(ref.Repository, bumpRequest.Prefix) {
+				continue
+			}
+			latest, ok := latestTags[ref.Repository]
+			if !ok {
+				searchRequest := &models.Search{
+					Type:    bumpRequest.Type,
+					Url:     bumpRequest.Url,
+					Name:    ref.Repository,
+					Version: bumpRequest.Version,
+				}
+				logger.Info(i18n.T("搜索该镜像所有tag"), "image", searchRequest.Name)
+				latest, err = c.Latest(ctx, searchRequest)
+				if err != nil {
+					return updates, fmt.Errorf(i18n.T("镜像查询失败：%s：%w"), searchRequest.Name, err)
+				}
+				latestTags[ref.Repository] = latest
+			}
+			if latest == nil {
+				logger.Warn(i18n.T("未查询到最新版本"), "path", fmt.Sprintf("%s:%d", file, field.Line), "image", ref.Name())
+				continue
+			}
+			image := updatedImage(ref, latest)
+			if image == field.Value {
+				continue
+			}
+			fileUpdates = append(fileUpdates, &ImageUpdate{File: file, Line: field.Line, Path: field.Path, OldImage: field.Value, NewImage: image})
+			updated = append(updated, field)
+			images = append(images, image)
+		}
+		if len(updated) > 0 && !bumpRequest.DryRun {
+			if err := ioutil.WriteFile(file, manifest.ReplaceImages(b, updated, images), info.Mode()); err != nil {
+				return updates, fmt.Errorf(i18n.T("写入yaml文件失败：%w"), err)
+			}
+		}
+		updates = append(updates, fileUpdates...)
+	}
+	return updates, nil
+}
@@ -0,0 +1,91 @@
+package release
+
+import (
+	"context"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testCompose = `services:
+  website:
+    image: moebius/release/website:v1.9-1 # 网站
+  mysql:
+    image: mysql:5.7
+`
+
+func writeCompose(t *testing.T, content string) (string, string) {
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, file
+}
+
+func TestUpdateComposeRequiresPrefix(t *testing.T) {
+	dir, file := writeCompose(t, testCompose)
+	defer os.RemoveAll(dir)
+	if _, err := (&Client{}).UpdateCompose(context.Background(), &models.Compose{File: file}); err != ErrNoPrefix {
+		t.Fatalf("got %v, want ErrNoPrefix", err)
+	}
+}
+
+func TestUpdateCompose(t *testing.T) {
+	// 只有前缀匹配的镜像会被查询，mysql不在tag列表中
+	srv := newTagServer(map[string][]string{"moebius/release/website": {"v1.9-1", "v1.9-2"}})
+	defer srv.Close()
+	dir, file := writeCompose(t, testCompose)
+	defer os.RemoveAll(dir)
+
+	composeRequest := &models.Compose{Type: models.Registry, Url: srv.URL, File: file, Prefix: "moebius/release/"}
+	updates, err := (&Client{}).UpdateCompose(context.Background(), composeRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].NewImage != "moebius/release/website:v1.9-2" {
+		t.Fatalf("got %+v", updates)
+	}
+	b, _ := ioutil.ReadFile(file)
+	want := `services:
+  website:
+    image: moebius/release/website:v1.9-2 # 网站
+  mysql:
+    image: mysql:5.7
+`
+	if string(b) != want {
+		t.Fatalf("got\n%s", b)
+	}
+}
+
+func TestUpdateComposeSkipsWriteWithoutChanges(t *testing.T) {
+	srv := newTagServer(map[string][]string{"moebius/release/website": {"v1.9-1"}})
+	defer srv.Close()
+	dir, file := writeCompose(t, testCompose)
+	defer os.RemoveAll(dir)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := (&Client{}).UpdateCompose(context.Background(), &models.Compose{Type: models.Registry, Url: srv.URL, File: file, Prefix: "moebius/release/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 0 {
+		t.Fatalf("got %+v", updates)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Fatal("file was rewritten without changes")
+	}
+}
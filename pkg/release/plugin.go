@@ -0,0 +1,198 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"strings"
+)
+
+// 插件最新版本
+type Plugin struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DownloadUrl string `json:"download_url"`
+	Sha256      string `json:"sha256,omitempty"`
+}
+
+// 查询插件最新版本下载地址，Name为空时返回所有插件
+func (c *Client) LatestPlugins(ctx context.Context, searchRequest *models.PluginSearch) ([]*Plugin, error) {
+	p, err := c.PluginIndex(ctx, searchRequest.Url)
+	if err != nil {
+		return nil, err
+	}
+	plugins := []*Plugin{}
+	for _, pl := range p.Plugins {
+		if searchRequest.Name != "" && searchRequest.Name != pl.Name {
+			continue
+		}
+		versions, err := CompatibleVersions(pl, searchRequest.Platform)
+		if err != nil {
+			return nil, err
+		}
+		plugin := &Plugin{Name: pl.Name}
+		if v := LatestPluginVersion(versions, searchRequest.Version); v != nil {
+			plugin.Version, plugin.DownloadUrl, plugin.Sha256 = v.Version, v.DownloadUrl, v.Sha256
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// 查询插件列表中的插件及指定版本，version为空或latest时为最新版本
+func (c *Client) FindPlugin(ctx context.Context, url, name, version string) (*models.PluginDetail, *models.PluginVersion, error) {
+	if version == "" {
+		version = "latest"
+	}
+	p, err := c.PluginIndex(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pl := range p.Plugins {
+		if pl.Name != name {
+			continue
+		}
+		v := LatestPluginVersion(pl.Versions, version)
+		if v == nil || (version != "latest" && v.Version != version) {
+			return nil, nil, errors.New(i18n.T("未查询到插件版本：%s", name+"@"+version))
+		}
+		return pl, v, nil
+	}
+	return nil, nil, errors.New(i18n.T("未查询到插件：%s", name))
+}
+
+// 计算最新的插件版本，返回下载地址与版本号；version不为空且不为latest时返回该版本
+func PluginVersion(it []*models.PluginVersion, version string) (string, string) {
+	v := LatestPluginVersion(it, version)
+	if v == nil {
+		return "", ""
+	}
+	return v.DownloadUrl, v.Version
+}
+
+// 计算最新的插件版本，version不为空且不为latest时返回该版本，插件没有版本时返回nil
+func LatestPluginVersion(it []*models.PluginVersion, version string) *models.PluginVersion {
+	if len(it) == 0 {
+		return nil
+	}
+	var latest *models.PluginVersion
+	var latestVersion *pluginVersion
+	for _, t := range it {
+		if version != "latest" && version != "" {
+			if t.Version == version {
+				return t
+			}
+		}
+		// 版本号无法解析时忽略，相同版本取靠前的
+		v, err := parsePluginVersion(t.Version)
+		if err != nil {
+			continue
+		}
+		if latestVersion == nil || comparePluginVersion(v, latestVersion) > 0 {
+			latest, latestVersion = t, v
+		}
+	}
+	return latest
+}
+
+// 插件版本_后的后缀，如 1.2.0-3_x86 的后缀为x86，没有后缀时返回空
+func PluginSuffix(version string) string {
+	if i := strings.Index(version, "_"); i >= 0 {
+		return version[i+1:]
+	}
+	return ""
+}
+
+// 后缀与suffix相同的插件版本，不同后缀对应不同架构，不能互相升级
+func SuffixVersions(it []*models.PluginVersion, suffix string) []*models.PluginVersion {
+	versions := []*models.PluginVersion{}
+	for _, v := range it {
+		if PluginSuffix(v.Version) == suffix {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// latest比installed版本新时返回true，后缀不同时不比较，installed无法解析时只要版本不同即认为有新版本
+func PluginNewer(installed, latest string) bool {
+	if installed == latest || PluginSuffix(installed) != PluginSuffix(latest) {
+		return false
+	}
+	l, err := parsePluginVersion(latest)
+	if err != nil {
+		return false
+	}
+	i, err := parsePluginVersion(installed)
+	if err != nil {
+		return true
+	}
+	return comparePluginVersion(l, i) > 0
+}
+
+// 已安装插件与插件列表中最新版本的比较结果
+type PluginUpdate struct {
+	Installed *models.Plugin
+	Detail    *models.PluginDetail  // 插件列表中未查询到时为nil
+	Latest    *models.PluginVersion // 插件列表中后缀相同的最新版本，未查询到时为nil
+}
+
+// 插件列表中有更新的版本
+func (u *PluginUpdate) Outdated() bool {
+	return u.Latest != nil && PluginNewer(u.Installed.Version, u.Latest.Version)
+}
+
+// 查询插件列表，计算已安装插件兼容platform且后缀相同的最新版本，platform为空时不检查兼容性
+func (c *Client) CheckPlugins(ctx context.Context, url, platform string, installed []*models.Plugin) ([]*PluginUpdate, error) {
+	p, err := c.PluginIndex(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]*models.PluginDetail{}
+	for _, pl := range p.Plugins {
+		details[pl.Name] = pl
+	}
+	updates := make([]*PluginUpdate, 0, len(installed))
+	for _, pl := range installed {
+		u := &PluginUpdate{Installed: pl}
+		if detail, ok := details[pl.Name]; ok {
+			versions, err := CompatibleVersions(detail, platform)
+			if err != nil {
+				return nil, err
+			}
+			u.Detail = detail
+			u.Latest = LatestPluginVersion(SuffixVersions(versions, PluginSuffix(pl.Version)), "")
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// 兼容平台版本的插件版本，platform为空时返回所有版本
+func CompatibleVersions(detail *models.PluginDetail, platform string) ([]*models.PluginVersion, error) {
+	if platform == "" {
+		return detail.Versions, nil
+	}
+	versions := []*models.PluginVersion{}
+	for _, v := range detail.Versions {
+		ok, err := PluginCompatible(v, platform)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("插件%s@%s的compatible不正确：%w"), detail.Name, v.Version, err)
+		}
+		if ok {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// 查询插件列表并解析插件依赖，requests为插件名称与版本约束，已安装插件一并参与解析
+func (c *Client) ResolvePlugins(ctx context.Context, url, platform string, installed []*models.Plugin, requests map[string]string) ([]*ResolvedPlugin, error) {
+	p, err := c.PluginIndex(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return NewPluginResolver(p, platform, installed).Resolve(requests)
+}
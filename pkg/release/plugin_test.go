@@ -0,0 +1,37 @@
+package release
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"testing"
+)
+
+func TestPluginNewer(t *testing.T) {
+	cases := []struct {
+		installed, latest string
+		newer             bool
+	}{
+		{"1.2.0-3_x86", "1.2.0-4_x86", true},
+		{"1.2.0-3_x86", "1.2.0-3_x86", false},
+		{"1.2.0-4_x86", "1.2.0-3_x86", false},
+		// 后缀不同为不同架构，不作为升级
+		{"1.2.0-3_x86", "1.2.0-4_arm", false},
+		{"1.2.0-3", "1.2.0-4_x86", false},
+		{"1.2.0-3", "1.3.0", true},
+	}
+	for _, c := range cases {
+		if got := PluginNewer(c.installed, c.latest); got != c.newer {
+			t.Errorf("PluginNewer(%q, %q) = %v, want %v", c.installed, c.latest, got, c.newer)
+		}
+	}
+}
+
+func TestSuffixVersions(t *testing.T) {
+	versions := []*models.PluginVersion{{Version: "1.2.0-4_arm"}, {Version: "1.2.0-3_x86"}, {Version: "1.2.0-2_x86"}, {Version: "1.2.0-5"}}
+	latest := LatestPluginVersion(SuffixVersions(versions, PluginSuffix("1.2.0-2_x86")), "")
+	if latest == nil || latest.Version != "1.2.0-3_x86" {
+		t.Fatalf("got %v, want 1.2.0-3_x86", latest)
+	}
+	if latest := LatestPluginVersion(SuffixVersions(versions, ""), ""); latest == nil || latest.Version != "1.2.0-5" {
+		t.Fatalf("got %v, want 1.2.0-5", latest)
+	}
+}
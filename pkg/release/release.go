@@ -0,0 +1,369 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/metrics"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/render"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// release生成结果
+type Result struct {
+	ReleasePath string                 // 生成的release目录
+	Format      string                 // 输出格式
+	Images      []*models.ReleaseImage // 各组件镜像
+	Summary     *Summary               // 各组件处理结果
+}
+
+var ErrInvalidFormat = i18n.NewError("输出格式不正确，支持raw/helm/kustomize")
+
+// 模板目录、镜像前缀与域名的默认值
+func TemplateDefaults(releaseRequest *models.Release) error {
+	if releaseRequest.TemplatePath == "" {
+		releaseRequest.TemplatePath = "/tmp/template"
+	}
+	if _, err := os.Stat(releaseRequest.TemplatePath); err != nil {
+		return errors.New(i18n.T("模板文件目录不存在：%s", releaseRequest.TemplatePath))
+	}
+	if releaseRequest.Prefix == "" {
+		releaseRequest.Prefix = "moebius/release/"
+	}
+	if !strings.HasSuffix(releaseRequest.Prefix, "/") {
+		releaseRequest.Prefix = releaseRequest.Prefix + "/"
+	}
+	if releaseRequest.Domain != "" && !strings.HasSuffix(releaseRequest.Domain, "/") {
+		releaseRequest.Domain = releaseRequest.Domain + "/"
+	}
+	return nil
+}
+
+// release目录、输出格式与chart名称的默认值
+func Defaults(releaseRequest *models.Release) error {
+	if err := TemplateDefaults(releaseRequest); err != nil {
+		return err
+	}
+	if releaseRequest.ReleasePath == "" {
+		releaseRequest.ReleasePath = "/tmp/release"
+	}
+	releaseRequest.Format = strings.ToLower(releaseRequest.Format)
+	if releaseRequest.Format == "" {
+		releaseRequest.Format = models.FormatRaw
+	}
+	if releaseRequest.Format != models.FormatRaw && releaseRequest.Format != models.FormatHelm && releaseRequest.Format != models.FormatKustomize {
+		return ErrInvalidFormat
+	}
+	if releaseRequest.ChartName == "" {
+		releaseRequest.ChartName = "release"
+	}
+	failOn, err := FailOnDefault(releaseRequest.FailOn)
+	if err != nil {
+		return err
+	}
+	releaseRequest.FailOn = failOn
+	return nil
+}
+
+// 生成release目录，Apply为true时生成后自动执行
+// 处理结果不满足FailOn策略时仍生成release目录，但不自动执行并返回ErrIncomplete
+func (c *Client) Generate(ctx context.Context, releaseRequest *models.Release) (result *Result, err error) {
+	if err := Defaults(releaseRequest); err != nil {
+		return nil, err
+	}
+	run := metrics.StartRelease(releaseRequest.Format)
+	defer func() {
+		if result != nil {
+			run.Done(len(result.Images), err)
+		} else {
+			run.Done(0, err)
+		}
+	}()
+
+	// 先在release目录同级的临时目录中生成，完成后替换release目录
+	// 失败或取消时删除临时目录，原release目录保持不变
+	releasePath := releaseRequest.ReleasePath
+	staging, err := stagingDir(releasePath)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("创建release目录失败：%w"), err)
+	}
+	defer os.RemoveAll(staging)
+	releaseRequest.ReleasePath = staging
+	defer func() { releaseRequest.ReleasePath = releasePath }()
+
+	images, summary, err := c.Resolve(ctx, releaseRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch releaseRequest.Format {
+	case models.FormatHelm:
+		if err := render.WriteHelmChart(releaseRequest, images); err != nil {
+			return nil, fmt.Errorf(i18n.T("生成helm chart失败：%w"), err)
+		}
+	case models.FormatKustomize:
+		if err := render.WriteKustomization(releaseRequest, images); err != nil {
+			return nil, fmt.Errorf(i18n.T("生成kustomization失败：%w"), err)
+		}
+	default:
+		for _, image := range images {
+			// 替换yaml中{{image}}并将yaml挪到指定位置
+			err = utils.MoveYamlToReleaseDir(releaseRequest.TemplatePath, releaseRequest.ReleasePath, image.Image(), image.TemplateFile)
+			if err != nil {
+				return nil, fmt.Errorf(i18n.T("yaml迁移失败：%w"), err)
+			}
+		}
+	}
+
+	if err := utils.WriteReleaseLock(releaseRequest.ReleasePath, releaseRequest.Version, releaseRequest.Prefix, images); err != nil {
+		return nil, fmt.Errorf(i18n.T("生成release.lock失败：%w"), err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(releasePath); err != nil {
+		return nil, fmt.Errorf(i18n.T("删除原release目录失败：%w"), err)
+	}
+	if err := os.Rename(staging, releasePath); err != nil {
+		return nil, fmt.Errorf(i18n.T("生成release目录失败：%w"), err)
+	}
+	releaseRequest.ReleasePath = releasePath
+
+	for _, image := range images {
+		if image.Hold != "" {
+			logger.Info(i18n.T("组件版本已锁定"), "component", image.Component, "hold", image.Hold, "tag", image.Tag)
+		}
+	}
+	_ = c.Notifier.Send(ctx, &models.NotifyEvent{
+		Type:        models.EventReleaseGenerated,
+		Version:     releaseRequest.Version,
+		ReleasePath: releaseRequest.ReleasePath,
+		Images:      images,
+	})
+	result = &Result{
+		ReleasePath: releaseRequest.ReleasePath,
+		Format:      releaseRequest.Format,
+		Images:      images,
+		Summary:     summary,
+	}
+	summary.Log()
+	if err := summary.Check(releaseRequest.FailOn); err != nil {
+		return result, err
+	}
+	if releaseRequest.Apply {
+		if err := c.Apply(ctx, releaseRequest, images); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// 在release目录同级创建临时目录，保证kustomize base等相对路径与release目录一致
+func stagingDir(releasePath string) (string, error) {
+	parent := filepath.Dir(filepath.Clean(releasePath))
+	if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir(parent, "."+filepath.Base(filepath.Clean(releasePath))+".")
+	if err != nil {
+		return "", err
+	}
+	return dir, os.Chmod(dir, 0755)
+}
+
+// 遍历模板目录并计算各组件镜像版本，锁定的组件使用锁定版本
+// 未查询到镜像的组件记为跳过；KeepGoing为true时查询失败的组件记为失败并继续处理其他组件
+func (c *Client) Resolve(ctx context.Context, releaseRequest *models.Release) ([]*models.ReleaseImage, *Summary, error) {
+	imageNameList, imagePathMap, err := TemplateImages(releaseRequest.TemplatePath, releaseRequest.Prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf(i18n.T("获取镜像名称失败：%w"), err)
+	}
+
+	holds, err := LoadHolds(releaseRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf(i18n.T("读取组件版本锁定失败：%w"), err)
+	}
+
+	images := []*models.ReleaseImage{}
+	summary := &Summary{}
+	for _, name := range imageNameList {
+		// 锁定项可使用组件名称或完整镜像名称
+		component := name[len(releaseRequest.Prefix):]
+		version, held := holds[component]
+		if !held {
+			version, held = holds[name]
+		}
+		delete(holds, component)
+		delete(holds, name)
+		if !held {
+			version = releaseRequest.Version
+		}
+
+		searchRequest := &models.Search{
+			Type:    releaseRequest.Type,
+			Url:     releaseRequest.Url,
+			Name:    name,
+			Version: version,
+			Fresh:   releaseRequest.Fresh,
+		}
+		// 锁定到完整tag时同样查询镜像仓库，确认tag存在并取得digest
+		exact := held && utils.IsReleaseTag(version)
+		var t *models.ImageTags
+		if exact {
+			logger.Info(i18n.T("组件已锁定版本"), "component", component, "version", version)
+			t, err = c.Tag(ctx, searchRequest, version)
+		} else {
+			logger.Info(i18n.T("搜索该镜像所有tag"), "image", searchRequest.Name)
+			t, err = c.Latest(ctx, searchRequest)
+		}
+		if err != nil {
+			if !releaseRequest.KeepGoing || ctx.Err() != nil {
+				return nil, nil, fmt.Errorf(i18n.T("镜像查询失败：%s：%w"), name, err)
+			}
+			logger.Error(i18n.T("镜像查询失败"), "image", name, "error", err)
+			summary.Failed(component, err)
+			continue
+		}
+		if t == nil && exact {
+			// 锁定的tag不存在时记为失败，由--fail-on决定是否失败退出
+			err := errors.New(i18n.T("锁定的镜像tag不存在：%s", name+":"+version))
+			logger.Error(i18n.T("锁定的镜像tag不存在"), "component", component, "tag", version)
+			summary.Failed(component, err)
+			continue
+		}
+		latest := &models.ImageTags{}
+		if t != nil {
+			latest = t
+		}
+		image := &models.ReleaseImage{
+			Component:    component,
+			Name:         releaseRequest.Domain + name,
+			Tag:          latest.ImageTag,
+			Digest:       latest.Digest,
+			TemplateFile: imagePathMap[name],
+		}
+		if held {
+			image.Hold = version
+		}
+		if image.Tag == "" {
+			reason := i18n.T("未查询到release镜像")
+			if held {
+				reason = i18n.T("未查询到锁定版本%s下的镜像", version)
+			} else if version != "" {
+				reason = i18n.T("未查询到版本%s下的镜像", version)
+			}
+			logger.Warn(reason, "component", component)
+			summary.Skipped(component, reason)
+			continue
+		}
+		logger.Info(i18n.T("最新镜像"), "image", image.Image())
+		images = append(images, image)
+		summary.Succeeded(component, image.Image())
+	}
+	for component := range holds {
+		logger.Warn(i18n.T("锁定组件不存在于模板目录，已忽略"), "component", component)
+	}
+	return images, summary, nil
+}
+
+// 遍历模板目录，模板文件名即为镜像名称
+func TemplateImages(templatePath, prefix string) ([]string, map[string]string, error) {
+	imageNameList := []string{}
+	imagePathMap := map[string]string{}
+	err := filepath.Walk(templatePath, func(path string, info os.FileInfo, err error) error {
+		if info == nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		logger.Debug(i18n.T("模板yaml"), "path", path)
+		// kustomize base目录中的kustomization.yaml不是组件模板
+		if info.Name() == "kustomization.yaml" {
+			return nil
+		}
+		if strings.HasSuffix(path, ".yaml") {
+			path1 := strings.Replace(path, "\\", "/", -1)
+			path2 := strings.Split(path1[:len(path1)-5], "/")
+			imageName := fmt.Sprintf("%s%s", prefix, path2[len(path2)-1])
+			imageNameList = append(imageNameList, imageName)
+			imagePathMap[imageName] = path
+		}
+		return nil
+
+	})
+	return imageNameList, imagePathMap, err
+}
+
+// 合并锁定文件与--set指定的组件版本，--set优先
+func LoadHolds(releaseRequest *models.Release) (map[string]string, error) {
+	holdFile := releaseRequest.HoldFile
+	if holdFile == "" {
+		defaultHoldFile := filepath.Join(releaseRequest.TemplatePath, "hold.conf")
+		if _, err := os.Stat(defaultHoldFile); err == nil {
+			holdFile = defaultHoldFile
+		}
+	}
+	holds := map[string]string{}
+	if holdFile != "" {
+		logger.Info(i18n.T("读取组件版本锁定文件"), "path", holdFile)
+		h, err := utils.ReadHoldFile(holdFile)
+		if err != nil {
+			return nil, err
+		}
+		holds = h
+	}
+	sets, err := utils.ParseHolds(releaseRequest.Sets)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range sets {
+		holds[k] = v
+	}
+	return holds, nil
+}
+
+// 在kubernetes中执行release目录，需要在kubernetes master节点执行
+func (c *Client) Apply(ctx context.Context, releaseRequest *models.Release, images []*models.ReleaseImage) error {
+	logger.Info(i18n.T("此命令需要在kubernetes master节点执行"))
+	var cmd *exec.Cmd
+	switch releaseRequest.Format {
+	case models.FormatHelm:
+		logger.Info(fmt.Sprintf("helm upgrade --install %s %s", releaseRequest.ChartName, releaseRequest.ReleasePath))
+		cmd = exec.CommandContext(ctx, "helm", "upgrade", "--install", releaseRequest.ChartName, releaseRequest.ReleasePath)
+	case models.FormatKustomize:
+		logger.Info(fmt.Sprintf("kubectl apply -k %s", releaseRequest.ReleasePath))
+		cmd = exec.CommandContext(ctx, "kubectl", "apply", "-k", releaseRequest.ReleasePath)
+	default:
+		logger.Info(fmt.Sprintf("kubectl delete -f %s && kubectl apply -f %s", releaseRequest.ReleasePath, releaseRequest.ReleasePath))
+		cmd = exec.CommandContext(ctx, "kubectl", "delete", "-f", releaseRequest.ReleasePath, "&&", "kubectl", "apply", "-f", releaseRequest.ReleasePath)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if c.Output != nil {
+		cmd.Stdout = c.Output
+		cmd.Stderr = c.Output
+	}
+	event := &models.NotifyEvent{
+		Type:        models.EventReleaseApplied,
+		Version:     releaseRequest.Version,
+		ReleasePath: releaseRequest.ReleasePath,
+		Images:      images,
+	}
+	if err := cmd.Run(); err != nil {
+		event.Type = models.EventApplyFailed
+		event.Error = err.Error()
+		_ = c.Notifier.Send(ctx, event)
+		return fmt.Errorf(i18n.T("执行%s命令失败：%w"), cmd.Args[0], err)
+	}
+	_ = c.Notifier.Send(ctx, event)
+	return nil
+}
@@ -0,0 +1,237 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 只实现tags/list的registry，返回镜像名称对应的tag列表
+func newTagServer(tags map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/tags/list")
+		list, ok := tags[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"tags": list})
+	}))
+}
+
+// 模板目录，每个组件一个yaml
+func newTemplateDir(t *testing.T, components ...string) string {
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range components {
+		content := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: " + component + "\nspec:\n  template:\n    spec:\n      containers:\n        - name: " + component + "\n          image: {{image}}\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, component+".yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func componentStatus(summary *Summary) map[string]string {
+	status := map[string]string{}
+	for _, c := range summary.Components {
+		status[c.Component] = c.Status
+	}
+	return status
+}
+
+func TestLoadHoldsSetsOverrideHoldFile(t *testing.T) {
+	dir := newTemplateDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hold.conf"), []byte("website=v1.8\ngateway=v1.9-3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	holds, err := LoadHolds(&models.Release{TemplatePath: dir, Sets: []string{"website=v1.9-10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 2 || holds["website"] != "v1.9-10" || holds["gateway"] != "v1.9-3" {
+		t.Fatalf("got %v", holds)
+	}
+
+	if _, err := LoadHolds(&models.Release{TemplatePath: dir, Sets: []string{"website"}}); err == nil {
+		t.Fatal("expected an error for a malformed --set")
+	}
+}
+
+func TestResolveHolds(t *testing.T) {
+	srv := newTagServer(map[string][]string{
+		"moebius/release/website": {"v1.8-2", "v1.8-5", "v1.9-1", "v1.9-10"},
+		"moebius/release/gateway": {"v1.9-3", "v1.9-4"},
+		"moebius/release/auth":    {"v1.9-7"},
+	})
+	defer srv.Close()
+	dir := newTemplateDir(t, "website", "gateway", "auth")
+	defer os.RemoveAll(dir)
+
+	releaseRequest := &models.Release{
+		Type:         models.Registry,
+		Url:          srv.URL,
+		TemplatePath: dir,
+		Version:      "v1.9",
+		// 大版本锁定、完整tag锁定、不存在的tag
+		Sets: []string{"website=v1.8", "moebius/release/gateway=v1.9-3", "auth=v1.9-8"},
+	}
+	if err := TemplateDefaults(releaseRequest); err != nil {
+		t.Fatal(err)
+	}
+	images, summary, err := (&Client{}).Resolve(context.Background(), releaseRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, image := range images {
+		got[image.Component] = image.Tag + " " + image.Hold
+	}
+	if len(got) != 2 || got["website"] != "v1.8-5 v1.8" || got["gateway"] != "v1.9-3 v1.9-3" {
+		t.Fatalf("got %v", got)
+	}
+	if status := componentStatus(summary); status["auth"] != StatusFailed {
+		t.Fatalf("a missing held tag should fail the component, got %v", status)
+	}
+	if err := summary.Check(models.FailOnError); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("got %v, want ErrIncomplete", err)
+	}
+}
+
+func TestLatestImagesHolds(t *testing.T) {
+	srv := newTagServer(map[string][]string{
+		"website": {"v1.9-1", "v1.9-10"},
+		"gateway": {"v1.9-3"},
+	})
+	defer srv.Close()
+	images, summary, err := (&Client{}).LatestImages(context.Background(), &models.Search{Type: models.Registry, Url: srv.URL}, []string{"website", "gateway=v1.9-3", "website=v1.9-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images[0].Tag != "v1.9-10" || !images[1].Held() || images[2].Error == "" {
+		t.Fatalf("got %+v %+v %+v", images[0], images[1], images[2])
+	}
+	if summary.Count(StatusFailed) != 1 || summary.Count(StatusSucceeded) != 2 {
+		t.Fatalf("got %+v", summary.Components)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	srv := newTagServer(map[string][]string{
+		"moebius/release/website": {"v1.9-1", "v1.9-10"},
+		"moebius/release/gateway": {"v1.9-3", "v1.8-7"},
+	})
+	defer srv.Close()
+	dir := newTemplateDir(t, "website", "gateway")
+	defer os.RemoveAll(dir)
+	parent, err := ioutil.TempDir("", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	releasePath := filepath.Join(parent, "release")
+	// 已有的release目录整体被替换
+	if err := os.MkdirAll(releasePath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(releasePath, "stale.yaml"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	releaseRequest := &models.Release{
+		Type:         models.Registry,
+		Url:          srv.URL,
+		TemplatePath: dir,
+		ReleasePath:  releasePath,
+		Version:      "v1.9",
+	}
+	result, err := (&Client{}).Generate(context.Background(), releaseRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReleasePath != releasePath || releaseRequest.ReleasePath != releasePath {
+		t.Fatalf("got release path %s, %s, want %s", result.ReleasePath, releaseRequest.ReleasePath, releasePath)
+	}
+	if _, err := os.Stat(filepath.Join(releasePath, "stale.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("the old release dir was not replaced: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(releasePath, "website.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "image: moebius/release/website:v1.9-10") {
+		t.Fatalf("image was not rendered:\n%s", b)
+	}
+	// 临时目录已重命名为release目录，同级不残留
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "release" {
+		t.Fatalf("staging dir left behind: %v", entries)
+	}
+
+	locks, err := utils.ReadReleaseLocks([]string{releasePath})
+	if err != nil || len(locks) != 1 {
+		t.Fatalf("got %v, %v", locks, err)
+	}
+	lock := locks[0]
+	if lock.Version != "v1.9" || lock.Prefix != "moebius/release/" || len(lock.Images) != 2 {
+		t.Fatalf("got release.lock %+v", lock)
+	}
+	got := map[string]string{}
+	for _, image := range lock.Images {
+		got[image.Component] = image.Image()
+	}
+	if got["website"] != "moebius/release/website:v1.9-10" || got["gateway"] != "moebius/release/gateway:v1.9-3" {
+		t.Fatalf("got release.lock images %v", got)
+	}
+}
+
+func TestGenerateKeepsReleaseDirOnError(t *testing.T) {
+	srv := newTagServer(map[string][]string{"moebius/release/website": {"v1.9-1"}})
+	defer srv.Close()
+	dir := newTemplateDir(t, "website")
+	defer os.RemoveAll(dir)
+	parent, err := ioutil.TempDir("", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	releasePath := filepath.Join(parent, "release")
+	if err := os.MkdirAll(releasePath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(releasePath, "website.yaml"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 取消后查询失败，原release目录不变且不残留临时目录
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	releaseRequest := &models.Release{Type: models.Registry, Url: srv.URL, TemplatePath: dir, ReleasePath: releasePath, Version: "v1.9"}
+	if _, err := (&Client{}).Generate(ctx, releaseRequest); err == nil {
+		t.Fatal("expected an error")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(releasePath, "website.yaml")); err != nil || string(b) != "old" {
+		t.Fatalf("the old release dir was changed: %q, %v", b, err)
+	}
+	if entries, _ := ioutil.ReadDir(parent); len(entries) != 1 {
+		t.Fatalf("staging dir left behind: %v", entries)
+	}
+	if releaseRequest.ReleasePath != releasePath {
+		t.Fatalf("release path not restored: %s", releaseRequest.ReleasePath)
+	}
+}
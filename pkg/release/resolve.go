@@ -0,0 +1,337 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"sort"
+	"strings"
+)
+
+var ErrUnsatisfiable = i18n.NewError("插件依赖无法满足")
+
+// 解析出的插件版本
+type ResolvedPlugin struct {
+	Detail    *models.PluginDetail
+	Version   *models.PluginVersion
+	Installed *models.Plugin // 已安装版本，未安装时为nil
+	Missing   bool           // 已安装但插件列表中未查询到，保持已安装版本
+}
+
+// 需要安装或变更版本
+func (p *ResolvedPlugin) Changed() bool {
+	return p.Installed == nil || p.Installed.Version != p.Version.Version
+}
+
+// 插件的一个版本约束及其来源
+type requirement struct {
+	from       string // 来源插件，如 website@1.2.0-1，为空时为命令行指定
+	constraint *Constraint
+}
+
+// 按插件列表中的requires与compatible选出一组相互满足的插件版本
+// 命令行指定的插件优先选择最新版本，其余已安装插件优先保持当前版本，无法满足时回溯尝试较旧版本
+// 已安装插件只选择_后缀(架构)相同的版本，约束中指定了后缀时选择该后缀
+type PluginResolver struct {
+	Platform string // 平台版本，为空时不检查compatible
+
+	index     map[string]*models.PluginDetail
+	installed map[string]*models.Plugin
+	requested map[string]bool
+
+	selected    map[string]*models.PluginVersion
+	constraints map[string][]requirement
+	err         error
+	reason      string // 最深一层的失败原因
+	reasonDepth int
+}
+
+func NewPluginResolver(list *models.PluginList, platform string, installed []*models.Plugin) *PluginResolver {
+	r := &PluginResolver{
+		Platform:  platform,
+		index:     map[string]*models.PluginDetail{},
+		installed: map[string]*models.Plugin{},
+	}
+	for _, pl := range list.Plugins {
+		r.index[pl.Name] = pl
+	}
+	for _, pl := range installed {
+		r.installed[pl.Name] = pl
+	}
+	return r
+}
+
+// requests为插件名称与版本约束，约束为空时选择最新版本；返回的插件按依赖顺序排列，被依赖的插件在前
+func (r *PluginResolver) Resolve(requests map[string]string) ([]*ResolvedPlugin, error) {
+	r.requested = map[string]bool{}
+	r.selected = map[string]*models.PluginVersion{}
+	r.constraints = map[string][]requirement{}
+	r.err, r.reason, r.reasonDepth = nil, "", 0
+
+	names := []string{}
+	for name, s := range requests {
+		if _, ok := r.detail(name); !ok {
+			return nil, errors.New(i18n.T("未查询到插件：%s", name))
+		}
+		c, err := ParseConstraint(s)
+		if err != nil {
+			return nil, err
+		}
+		r.requested[name] = true
+		r.constraints[name] = append(r.constraints[name], requirement{constraint: c})
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	others := []string{}
+	for name := range r.installed {
+		if !r.requested[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+
+	if !r.solve(append(names, others...), 0) {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf(i18n.T("%w：%s"), ErrUnsatisfiable, r.reason)
+	}
+	return r.ordered(), nil
+}
+
+func (r *PluginResolver) fail(depth int, reason string) {
+	if r.reason == "" || depth >= r.reasonDepth {
+		r.reason, r.reasonDepth = reason, depth
+	}
+}
+
+// 插件列表中的插件，已安装但插件列表中未查询到时只有已安装版本
+func (r *PluginResolver) detail(name string) (*models.PluginDetail, bool) {
+	if detail, ok := r.index[name]; ok {
+		return detail, true
+	}
+	if installed, ok := r.installed[name]; ok {
+		return &models.PluginDetail{
+			Name:        installed.Name,
+			Description: installed.Description,
+			Versions:    []*models.PluginVersion{{Version: installed.Version, DownloadUrl: installed.DownloadUrl}},
+		}, true
+	}
+	return nil, false
+}
+
+func (r *PluginResolver) solve(queue []string, depth int) bool {
+	if r.err != nil {
+		return false
+	}
+	if len(queue) == 0 {
+		return true
+	}
+	name, rest := queue[0], queue[1:]
+	if _, ok := r.selected[name]; ok {
+		return r.solve(rest, depth)
+	}
+	detail, ok := r.detail(name)
+	if !ok {
+		r.fail(depth, i18n.T("插件列表中未查询到插件%s，%s依赖该插件", name, r.sources(name)))
+		return false
+	}
+	for _, v := range r.candidates(detail, depth) {
+		deps, ok := r.selectVersion(name, v, depth)
+		if !ok {
+			continue
+		}
+		next := append(append([]string{}, deps...), rest...)
+		if r.solve(next, depth+1) {
+			return true
+		}
+		r.unselect(name, v)
+		if r.err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// 满足平台版本与当前约束的版本，按优先顺序排列
+func (r *PluginResolver) candidates(detail *models.PluginDetail, depth int) []*models.PluginVersion {
+	compatible, err := CompatibleVersions(detail, r.Platform)
+	if err != nil {
+		r.err = err
+		return nil
+	}
+	if len(detail.Versions) == 0 {
+		r.fail(depth, i18n.T("插件%s没有可用版本", detail.Name))
+		return nil
+	}
+	if len(compatible) == 0 {
+		r.fail(depth, i18n.T("平台版本%s不兼容插件%s的任何版本", r.Platform, detail.Name))
+		return nil
+	}
+	if suffix, ok := r.suffix(detail.Name); ok {
+		compatible = SuffixVersions(compatible, suffix)
+		if len(compatible) == 0 {
+			r.fail(depth, i18n.T("插件%s没有后缀为%s的版本", detail.Name, suffix))
+			return nil
+		}
+	}
+	matched := []*models.PluginVersion{}
+	for _, v := range compatible {
+		ok := true
+		for _, req := range r.constraints[detail.Name] {
+			if !req.constraint.Match(v.Version) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, v)
+		}
+	}
+	if len(matched) == 0 {
+		reason := i18n.T("插件%s没有满足约束的版本：%s", detail.Name, r.describe(detail.Name))
+		if r.Platform != "" {
+			reason += i18n.T("，平台版本%s", r.Platform)
+		}
+		r.fail(depth, reason)
+		return nil
+	}
+
+	// 新版本在前，无法解析的版本在最后；未在命令行指定的已安装插件优先保持当前版本
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, aerr := parsePluginVersion(matched[i].Version)
+		b, berr := parsePluginVersion(matched[j].Version)
+		if aerr != nil || berr != nil {
+			return aerr == nil
+		}
+		return comparePluginVersion(a, b) > 0
+	})
+	if installed, ok := r.installed[detail.Name]; ok && !r.requested[detail.Name] {
+		for i, v := range matched {
+			if v.Version == installed.Version {
+				matched = append([]*models.PluginVersion{v}, append(matched[:i:i], matched[i+1:]...)...)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// 候选版本的后缀，约束中指定了后缀时为该后缀，否则已安装插件保持已安装版本的后缀，返回false时不限制
+func (r *PluginResolver) suffix(name string) (string, bool) {
+	for _, req := range r.constraints[name] {
+		if suffix := req.constraint.Suffix(); suffix != "" {
+			return suffix, true
+		}
+	}
+	if installed, ok := r.installed[name]; ok {
+		return PluginSuffix(installed.Version), true
+	}
+	return "", false
+}
+
+// 选择插件版本并记录其依赖约束，与已选择的插件冲突时返回false
+func (r *PluginResolver) selectVersion(name string, v *models.PluginVersion, depth int) ([]string, bool) {
+	from := name + "@" + v.Version
+	deps := make([]string, 0, len(v.Requires))
+	for dep := range v.Requires {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	reqs := make(map[string]*Constraint, len(deps))
+	for _, dep := range deps {
+		c, err := ParseConstraint(v.Requires[dep])
+		if err != nil {
+			r.err = fmt.Errorf(i18n.T("插件%s的requires不正确：%w"), from, err)
+			return nil, false
+		}
+		if selected, ok := r.selected[dep]; ok && !c.Match(selected.Version) {
+			r.fail(depth, i18n.T("%s要求%s %s，已选择%s", from, dep, c, selected.Version))
+			return nil, false
+		}
+		reqs[dep] = c
+	}
+	r.selected[name] = v
+	for _, dep := range deps {
+		r.constraints[dep] = append(r.constraints[dep], requirement{from: from, constraint: reqs[dep]})
+	}
+	return deps, true
+}
+
+func (r *PluginResolver) unselect(name string, v *models.PluginVersion) {
+	from := name + "@" + v.Version
+	delete(r.selected, name)
+	for dep := range v.Requires {
+		kept := r.constraints[dep][:0]
+		for _, req := range r.constraints[dep] {
+			if req.from != from {
+				kept = append(kept, req)
+			}
+		}
+		r.constraints[dep] = kept
+	}
+}
+
+// 依赖该插件的来源
+func (r *PluginResolver) sources(name string) string {
+	sources := []string{}
+	for _, req := range r.constraints[name] {
+		if req.from != "" {
+			sources = append(sources, req.from)
+		}
+	}
+	return strings.Join(sources, ", ")
+}
+
+// 插件上的所有约束及来源，如 website@1.2.0-1要求>=2.0
+func (r *PluginResolver) describe(name string) string {
+	reqs := []string{}
+	for _, req := range r.constraints[name] {
+		if req.from == "" {
+			reqs = append(reqs, i18n.T("指定版本%s", req.constraint))
+		} else {
+			reqs = append(reqs, i18n.T("%s要求%s", req.from, req.constraint))
+		}
+	}
+	return strings.Join(reqs, "；")
+}
+
+// 按依赖顺序输出已选择的插件
+func (r *PluginResolver) ordered() []*ResolvedPlugin {
+	names := make([]string, 0, len(r.selected))
+	for name := range r.selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	visited := map[string]bool{}
+	resolved := make([]*ResolvedPlugin, 0, len(names))
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		v := r.selected[name]
+		deps := make([]string, 0, len(v.Requires))
+		for dep := range v.Requires {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			visit(dep)
+		}
+		detail, _ := r.detail(name)
+		_, inIndex := r.index[name]
+		resolved = append(resolved, &ResolvedPlugin{
+			Detail:    detail,
+			Version:   v,
+			Installed: r.installed[name],
+			Missing:   !inIndex,
+		})
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return resolved
+}
@@ -0,0 +1,146 @@
+package release
+
+import (
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"testing"
+)
+
+func pluginList(details ...*models.PluginDetail) *models.PluginList {
+	return &models.PluginList{Plugins: details}
+}
+
+func pluginDetail(name string, versions ...*models.PluginVersion) *models.PluginDetail {
+	return &models.PluginDetail{Name: name, Versions: versions}
+}
+
+// 解析结果中插件名称到版本的映射
+func resolvedVersions(resolved []*ResolvedPlugin) map[string]string {
+	versions := map[string]string{}
+	for _, p := range resolved {
+		versions[p.Detail.Name] = p.Version.Version
+	}
+	return versions
+}
+
+func assertResolved(t *testing.T, resolved []*ResolvedPlugin, want map[string]string) {
+	got := resolvedVersions(resolved)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for name, version := range want {
+		if got[name] != version {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResolveKeepsInstalledSuffix(t *testing.T) {
+	list := pluginList(pluginDetail("mysql",
+		&models.PluginVersion{Version: "1.2.0-5_arm"},
+		&models.PluginVersion{Version: "1.2.0-3_arm"},
+		&models.PluginVersion{Version: "1.2.0-4_x86"},
+		&models.PluginVersion{Version: "1.2.0-3_x86"},
+	))
+	installed := []*models.Plugin{{Name: "mysql", Version: "1.2.0-3_x86"}}
+
+	resolved, err := NewPluginResolver(list, "", installed).Resolve(map[string]string{"mysql": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"mysql": "1.2.0-4_x86"})
+
+	// 约束指定后缀时切换到该后缀
+	resolved, err = NewPluginResolver(list, "", installed).Resolve(map[string]string{"mysql": "=1.2.0-3_arm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"mysql": "1.2.0-3_arm"})
+}
+
+func TestResolveFailsWithoutInstalledSuffix(t *testing.T) {
+	list := pluginList(pluginDetail("mysql", &models.PluginVersion{Version: "1.2.0-4_arm"}))
+	installed := []*models.Plugin{{Name: "mysql", Version: "1.2.0-3_x86"}}
+	_, err := NewPluginResolver(list, "", installed).Resolve(map[string]string{"mysql": ""})
+	if !errors.Is(err, ErrUnsatisfiable) {
+		t.Fatalf("got %v, want ErrUnsatisfiable", err)
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	list := pluginList(
+		pluginDetail("website",
+			&models.PluginVersion{Version: "2.0.0-1", Requires: map[string]string{"mysql": ">=1.3"}},
+			&models.PluginVersion{Version: "1.0.0-1", Requires: map[string]string{"mysql": ">=1.2, <1.3"}},
+		),
+		pluginDetail("mysql",
+			&models.PluginVersion{Version: "1.3.0-1"},
+			&models.PluginVersion{Version: "1.2.0-2"},
+		),
+	)
+	resolved, err := NewPluginResolver(list, "", nil).Resolve(map[string]string{"website": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"website": "2.0.0-1", "mysql": "1.3.0-1"})
+	// 被依赖的插件在前
+	if resolved[0].Detail.Name != "mysql" || resolved[0].Installed != nil || !resolved[0].Changed() {
+		t.Fatalf("got %s first, want mysql to be installed first", resolved[0].Detail.Name)
+	}
+}
+
+func TestResolveBacktracksToOlderVersion(t *testing.T) {
+	list := pluginList(
+		pluginDetail("website",
+			&models.PluginVersion{Version: "2.0.0-1", Requires: map[string]string{"mysql": ">=1.3"}},
+			&models.PluginVersion{Version: "1.0.0-1", Requires: map[string]string{"mysql": "<1.3"}},
+		),
+		pluginDetail("mysql",
+			&models.PluginVersion{Version: "1.3.0-1"},
+			&models.PluginVersion{Version: "1.2.0-2"},
+		),
+	)
+	resolved, err := NewPluginResolver(list, "", nil).Resolve(map[string]string{"website": "", "mysql": "<1.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"website": "1.0.0-1", "mysql": "1.2.0-2"})
+}
+
+func TestResolveKeepsOtherInstalledVersions(t *testing.T) {
+	list := pluginList(
+		pluginDetail("website", &models.PluginVersion{Version: "1.1.0-1"}),
+		pluginDetail("redis", &models.PluginVersion{Version: "5.0.0-2"}, &models.PluginVersion{Version: "5.0.0-1"}),
+	)
+	installed := []*models.Plugin{{Name: "redis", Version: "5.0.0-1"}}
+	resolved, err := NewPluginResolver(list, "", installed).Resolve(map[string]string{"website": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"website": "1.1.0-1", "redis": "5.0.0-1"})
+	for _, p := range resolved {
+		if p.Detail.Name == "redis" && p.Changed() {
+			t.Fatal("redis should keep the installed version")
+		}
+	}
+}
+
+func TestResolvePlatformAndConflicts(t *testing.T) {
+	list := pluginList(
+		pluginDetail("website",
+			&models.PluginVersion{Version: "2.0.0-1", Compatible: ">=v2.0"},
+			&models.PluginVersion{Version: "1.0.0-1", Compatible: "<v2.0", Requires: map[string]string{"mysql": ">=2.0"}},
+		),
+		pluginDetail("mysql", &models.PluginVersion{Version: "1.2.0-2"}),
+	)
+	resolved, err := NewPluginResolver(list, "v2.1", nil).Resolve(map[string]string{"website": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResolved(t, resolved, map[string]string{"website": "2.0.0-1"})
+
+	_, err = NewPluginResolver(list, "v1.9", nil).Resolve(map[string]string{"website": ""})
+	if !errors.Is(err, ErrUnsatisfiable) {
+		t.Fatalf("got %v, want ErrUnsatisfiable", err)
+	}
+}
@@ -0,0 +1,196 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"regexp"
+	"strings"
+)
+
+// 查询镜像tag列表，优先使用未过期的缓存
+func (c *Client) Search(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if searchRequest.Type != "" && strings.ToLower(searchRequest.Type) != models.DockerHub && searchRequest.Url == "" {
+		return nil, errors.New(i18n.T("镜像仓库类型不为dockerHub的必须指定镜像仓库地址"))
+	}
+	if !searchRequest.Fresh {
+		if it, ok := c.Cache.Get(searchRequest.Type, searchRequest.Url, searchRequest.Name); ok {
+			return it, nil
+		}
+	}
+	it, err := searchRegistry(ctx, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Cache.Put(searchRequest.Type, searchRequest.Url, searchRequest.Name, it); err != nil {
+		logger.Warn(i18n.T("写入tag缓存失败"), "error", err)
+	}
+	return it, nil
+}
+
+func searchRegistry(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
+	switch strings.ToLower(searchRequest.Type) {
+	case "", models.DockerHub:
+		return repository.DockerHubTags(ctx, searchRequest)
+	case models.Nexus:
+		return repository.NexusSearchTags(ctx, searchRequest)
+	case models.Harbor:
+		return repository.HarborTags(ctx, searchRequest)
+	case models.Registry:
+		return repository.RegistryTags(ctx, searchRequest)
+	}
+	return nil, errors.New(i18n.T("镜像仓库类型不正确，支持nexus/harbor/dockerhub/registry"))
+}
+
+// 删除镜像tag，dockerHub不支持删除，删除后清除该镜像的tag缓存
+func (c *Client) DeleteTag(ctx context.Context, searchRequest *models.Search, tag *models.ImageTags) error {
+	var err error
+	switch strings.ToLower(searchRequest.Type) {
+	case models.Nexus:
+		err = repository.NexusDeleteTag(ctx, searchRequest, tag)
+	case models.Harbor:
+		err = repository.HarborDeleteTag(ctx, searchRequest, tag)
+	case models.Registry:
+		err = repository.RegistryDeleteTag(ctx, searchRequest, tag)
+	default:
+		return errors.New(i18n.T("镜像仓库类型不支持删除镜像，支持nexus/harbor/registry"))
+	}
+	if err != nil {
+		return err
+	}
+	return c.Cache.Delete(searchRequest.Type, searchRequest.Url, searchRequest.Name)
+}
+
+// 指定版本下的最新镜像，未查询到时返回nil
+func (c *Client) Latest(ctx context.Context, searchRequest *models.Search) (*models.ImageTags, error) {
+	it, err := c.Search(ctx, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	latestVersion := LatestVersion(it, searchRequest.Version)
+	for _, t := range it {
+		if latestVersion != "" && t.ImageTag == latestVersion {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// 查询指定tag，不存在时返回nil；缓存的tag列表中没有时重新查询镜像仓库，避免缓存后推送的tag被误判为不存在
+func (c *Client) Tag(ctx context.Context, searchRequest *models.Search, tag string) (*models.ImageTags, error) {
+	it, err := c.Search(ctx, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range it {
+		if t.ImageTag == tag {
+			return t, nil
+		}
+	}
+	if searchRequest.Fresh {
+		return nil, nil
+	}
+	fresh := *searchRequest
+	fresh.Fresh = true
+	return c.Tag(ctx, &fresh, tag)
+}
+
+// 镜像列表中一个镜像的最新版本
+type LatestImage struct {
+	Name  string // 镜像名称
+	Tag   string // 最新版本，未查询到时为空
+	Hold  string // 镜像名称=tag 形式锁定的版本
+	Error string // 查询失败的原因
+}
+
+// 锁定版本为完整tag且该tag存在
+func (i *LatestImage) Held() bool {
+	return i.Hold != "" && i.Hold == i.Tag
+}
+
+// 查询镜像列表中各镜像的最新版本，每行为镜像名称，支持 镜像名称=tag 形式锁定该镜像版本
+// KeepGoing为true时查询失败的镜像记为失败并继续查询其他镜像
+func (c *Client) LatestImages(ctx context.Context, searchRequest *models.Search, lines []string) ([]*LatestImage, *Summary, error) {
+	images := []*LatestImage{}
+	summary := &Summary{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		image := &LatestImage{Name: line}
+		version := searchRequest.Version
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			image.Name, image.Hold = kv[0], kv[1]
+			version = image.Hold
+		}
+		request := &models.Search{
+			Type:    searchRequest.Type,
+			Url:     searchRequest.Url,
+			Name:    image.Name,
+			Version: version,
+			Fresh:   searchRequest.Fresh,
+		}
+		exact := image.Hold != "" && utils.IsReleaseTag(image.Hold)
+		var latest *models.ImageTags
+		var err error
+		if exact {
+			latest, err = c.Tag(ctx, request, image.Hold)
+		} else {
+			latest, err = c.Latest(ctx, request)
+		}
+		if err != nil {
+			if !searchRequest.KeepGoing || ctx.Err() != nil {
+				return nil, nil, fmt.Errorf("%s：%w", image.Name, err)
+			}
+			image.Error = err.Error()
+			images = append(images, image)
+			summary.Failed(image.Name, err)
+			continue
+		}
+		images = append(images, image)
+		if latest == nil && exact {
+			// 锁定的tag不存在时记为失败，由--fail-on决定是否失败退出
+			err := errors.New(i18n.T("锁定的镜像tag不存在：%s", image.Name+":"+image.Hold))
+			image.Error = err.Error()
+			summary.Failed(image.Name, err)
+			continue
+		}
+		if latest == nil {
+			reason := i18n.T("未查询到最新版本")
+			if version != "" {
+				reason = i18n.T("未查询到版本%s下的镜像", version)
+			}
+			summary.Skipped(image.Name, reason)
+			continue
+		}
+		image.Tag = latest.ImageTag
+		summary.Succeeded(image.Name, image.Name+":"+image.Tag)
+	}
+	return images, summary, nil
+}
+
+// 只处理符合v1.8.2-10 格式的tag
+var releaseTagRegexp = regexp.MustCompile(`^v(\d+\.?){2,3}-\d+`)
+
+// 计算最新版本，version为空时计算所有版本中的最新版本
+func LatestVersion(it []*models.ImageTags, version string) string {
+	latestImageTag := ""
+	for _, t := range it {
+		if !releaseTagRegexp.MatchString(t.ImageTag) {
+			continue
+		}
+		if version == "" || strings.HasPrefix(t.ImageTag, version+"-") {
+			latestImageTag = utils.VersionCompare(latestImageTag, t.ImageTag)
+		}
+	}
+	return latestImageTag
+}
@@ -0,0 +1,175 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNoPluginSource = i18n.NewError("未配置插件列表地址，需指定-url或--plugin-config")
+
+// 读取插件列表来源配置文件，用户名、密码与token中的${环境变量}会被替换
+func LoadPluginConfig(path string) (*models.PluginConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &models.PluginConfig{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	for i, s := range config.Sources {
+		if s.Url == "" {
+			return nil, fmt.Errorf(i18n.T("第%d个插件列表来源未配置url"), i+1)
+		}
+		s.Username = os.ExpandEnv(s.Username)
+		s.Password = os.ExpandEnv(s.Password)
+		s.Token = os.ExpandEnv(s.Token)
+	}
+	return config, nil
+}
+
+// 逗号分隔的多个插件列表地址，靠前的优先
+func ParsePluginSources(urls string) []*models.PluginSource {
+	sources := []*models.PluginSource{}
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			sources = append(sources, &models.PluginSource{Url: u})
+		}
+	}
+	return sources
+}
+
+// url中的来源优先于配置文件中的来源
+func (c *Client) pluginSources(url string) []*models.PluginSource {
+	return append(ParsePluginSources(url), c.PluginSources...)
+}
+
+// 是否配置了插件列表来源
+func (c *Client) HasPluginSources(url string) bool {
+	return len(c.pluginSources(url)) > 0
+}
+
+// 按来源优先级查询并合并插件列表，url为逗号分隔的多个地址，优先于配置文件中的来源
+func (c *Client) PluginIndex(ctx context.Context, url string) (*models.PluginList, error) {
+	sources := c.pluginSources(url)
+	if len(sources) == 0 {
+		return nil, ErrNoPluginSource
+	}
+	lists := []*models.PluginList{}
+	owners := []*models.PluginSource{}
+	for _, source := range sources {
+		found, err := c.pluginSourceIndexes(ctx, source)
+		if err == nil {
+			for _, list := range found {
+				lists = append(lists, list)
+				owners = append(owners, source)
+			}
+			continue
+		}
+		if ctx.Err() != nil || !source.Optional {
+			return nil, err
+		}
+		logger.Warn(i18n.T("跳过查询失败的可选插件列表来源"), "source", repository.PluginSourceName(source), "error", err)
+	}
+	return MergePluginLists(lists, owners), nil
+}
+
+// 读取来源中的所有插件列表，任一插件列表读取失败时返回错误
+func (c *Client) pluginSourceIndexes(ctx context.Context, source *models.PluginSource) ([]*models.PluginList, error) {
+	expanded, err := expandPluginSource(source)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("查询插件列表失败：%s %w"), repository.PluginSourceName(source), err)
+	}
+	lists := make([]*models.PluginList, 0, len(expanded))
+	for _, s := range expanded {
+		list, err := repository.PluginIndex(ctx, s, c.PluginCache)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("查询插件列表失败：%s %w"), repository.PluginSourceName(s), err)
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// 目录来源展开为其中的.json/.yaml/.yml文件，按文件名排序，靠前的优先
+func expandPluginSource(source *models.PluginSource) ([]*models.PluginSource, error) {
+	if repository.IsHTTPSource(source.Url) {
+		return []*models.PluginSource{source}, nil
+	}
+	path := strings.TrimPrefix(source.Url, "file://")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []*models.PluginSource{source}, nil
+	}
+	files := []string{}
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	expanded := make([]*models.PluginSource, 0, len(files))
+	for _, f := range files {
+		s := *source
+		s.Url = f
+		s.Name = filepath.Join(repository.PluginSourceName(source), filepath.Base(f))
+		expanded = append(expanded, &s)
+	}
+	return expanded, nil
+}
+
+// 按来源优先级合并插件列表，lists[i]来自sources[i]，靠前的优先
+// 同名插件合并各来源的版本，同一版本以优先级高的来源为准，描述取第一个不为空的
+// exclusive来源中的插件屏蔽优先级更低的来源中的同名插件
+func MergePluginLists(lists []*models.PluginList, sources []*models.PluginSource) *models.PluginList {
+	merged := &models.PluginList{Plugins: []*models.PluginDetail{}}
+	details := map[string]*models.PluginDetail{}
+	owners := map[string]*models.PluginSource{}
+	for i, list := range lists {
+		source := sources[i]
+		for _, pl := range list.Plugins {
+			if owner, ok := owners[pl.Name]; ok && owner != source {
+				logger.Debug(i18n.T("插件被优先级更高的来源屏蔽"), "plugin", pl.Name, "source", repository.PluginSourceName(source), "owner", repository.PluginSourceName(owner))
+				continue
+			}
+			detail, ok := details[pl.Name]
+			if !ok {
+				detail = &models.PluginDetail{Name: pl.Name, Description: pl.Description}
+				details[pl.Name] = detail
+				merged.Plugins = append(merged.Plugins, detail)
+			} else if detail.Description == "" {
+				detail.Description = pl.Description
+			}
+			for _, v := range pl.Versions {
+				if findPluginVersion(detail.Versions, v.Version) != nil {
+					logger.Debug(i18n.T("插件版本被优先级更高的来源覆盖"), "plugin", pl.Name, "version", v.Version, "source", repository.PluginSourceName(source))
+					continue
+				}
+				detail.Versions = append(detail.Versions, v)
+			}
+		}
+		if source.Exclusive {
+			for _, pl := range list.Plugins {
+				if _, ok := owners[pl.Name]; !ok {
+					owners[pl.Name] = source
+				}
+			}
+		}
+	}
+	return merged
+}
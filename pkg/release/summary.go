@@ -0,0 +1,113 @@
+package release
+
+import (
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"strings"
+)
+
+// 组件处理结果
+const (
+	StatusSucceeded = "succeeded" // 已查询到镜像
+	StatusSkipped   = "skipped"   // 未查询到匹配版本的镜像
+	StatusFailed    = "failed"    // 查询失败
+)
+
+var ErrInvalidFailOn = i18n.NewError("--fail-on不正确，支持missing/error/none")
+
+// 不满足--fail-on策略时返回的错误
+var ErrIncomplete = i18n.NewError("存在未完成的组件")
+
+// 单个组件的处理结果
+type ComponentResult struct {
+	Component string // 组件或镜像名称
+	Image     string // 查询到的镜像，跳过或失败时为空
+	Status    string // succeeded/skipped/failed
+	Reason    string // 跳过或失败的原因
+}
+
+// 各组件处理结果汇总
+type Summary struct {
+	Components []*ComponentResult
+}
+
+func (s *Summary) add(component, image, status, reason string) {
+	s.Components = append(s.Components, &ComponentResult{
+		Component: component,
+		Image:     image,
+		Status:    status,
+		Reason:    reason,
+	})
+}
+
+func (s *Summary) Succeeded(component, image string) {
+	s.add(component, image, StatusSucceeded, "")
+}
+
+func (s *Summary) Skipped(component, reason string) {
+	s.add(component, "", StatusSkipped, reason)
+}
+
+func (s *Summary) Failed(component string, err error) {
+	s.add(component, "", StatusFailed, err.Error())
+}
+
+// 指定状态的组件数量
+func (s *Summary) Count(status string) int {
+	n := 0
+	for _, c := range s.Components {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// 输出成功、跳过、失败的组件及原因
+func (s *Summary) Log() {
+	logger.Info(i18n.T("处理结果"), StatusSucceeded, s.Count(StatusSucceeded), StatusSkipped, s.Count(StatusSkipped), StatusFailed, s.Count(StatusFailed))
+	for _, status := range []string{StatusSucceeded, StatusSkipped, StatusFailed} {
+		for _, c := range s.Components {
+			if c.Status != status {
+				continue
+			}
+			if c.Status == StatusSucceeded {
+				logger.Info(i18n.T("组件处理结果"), "status", c.Status, "component", c.Component, "image", c.Image)
+			} else {
+				logger.Warn(i18n.T("组件处理结果"), "status", c.Status, "component", c.Component, "reason", c.Reason)
+			}
+		}
+	}
+}
+
+// --fail-on的默认值与校验
+func FailOnDefault(failOn string) (string, error) {
+	failOn = strings.ToLower(failOn)
+	switch failOn {
+	case "":
+		return models.FailOnError, nil
+	case models.FailOnMissing, models.FailOnError, models.FailOnNone:
+		return failOn, nil
+	}
+	return "", ErrInvalidFailOn
+}
+
+// 按--fail-on策略检查处理结果，不满足时返回ErrIncomplete
+func (s *Summary) Check(failOn string) error {
+	failed, skipped := s.Count(StatusFailed), s.Count(StatusSkipped)
+	switch failOn {
+	case models.FailOnNone:
+		return nil
+	case models.FailOnMissing:
+		if failed+skipped > 0 {
+			return fmt.Errorf(i18n.T("%w：跳过%d个，失败%d个"), ErrIncomplete, skipped, failed)
+		}
+	default:
+		if failed > 0 {
+			return fmt.Errorf(i18n.T("%w：失败%d个"), ErrIncomplete, failed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailOnDefault(t *testing.T) {
+	for _, tc := range []struct {
+		failOn, want string
+		err          error
+	}{
+		{"", models.FailOnError, nil},
+		{"MISSING", models.FailOnMissing, nil},
+		{"error", models.FailOnError, nil},
+		{"none", models.FailOnNone, nil},
+		{"skipped", "", ErrInvalidFailOn},
+	} {
+		got, err := FailOnDefault(tc.failOn)
+		if got != tc.want || err != tc.err {
+			t.Errorf("FailOnDefault(%q) = %q, %v, want %q, %v", tc.failOn, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestSummaryCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		failOn          string
+		skipped, failed int
+		incomplete      bool
+	}{
+		{"none with failures", models.FailOnNone, 1, 1, false},
+		{"missing when complete", models.FailOnMissing, 0, 0, false},
+		{"missing with skipped", models.FailOnMissing, 1, 0, true},
+		{"missing with failed", models.FailOnMissing, 0, 1, true},
+		{"error when complete", models.FailOnError, 0, 0, false},
+		{"error with skipped", models.FailOnError, 2, 0, false},
+		{"error with failed", models.FailOnError, 0, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			summary := &Summary{}
+			summary.Succeeded("website", "moebius/release/website:v1.9-1")
+			for i := 0; i < tc.skipped; i++ {
+				summary.Skipped("gateway", "未查询到release镜像")
+			}
+			for i := 0; i < tc.failed; i++ {
+				summary.Failed("auth", errors.New("connection refused"))
+			}
+			err := summary.Check(tc.failOn)
+			if errors.Is(err, ErrIncomplete) != tc.incomplete {
+				t.Fatalf("Check(%s) = %v, want incomplete %v", tc.failOn, err, tc.incomplete)
+			}
+		})
+	}
+}
+
+func TestGenerateKeepGoing(t *testing.T) {
+	// auth查询返回500记为失败；gateway没有v1.9的tag，记为跳过
+	tags := newTagServer(map[string][]string{
+		"moebius/release/website": {"v1.9-1"},
+		"moebius/release/gateway": {"v1.8-7"},
+	})
+	defer tags.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/auth/") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		tags.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	repository.Configure(time.Second, 0)
+	defer repository.Configure(30*time.Second, 3)
+	dir := newTemplateDir(t, "website", "gateway", "auth")
+	defer os.RemoveAll(dir)
+	parent, err := ioutil.TempDir("", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+
+	for _, tc := range []struct {
+		failOn     string
+		incomplete bool
+	}{
+		{"", true},
+		{models.FailOnMissing, true},
+		{models.FailOnNone, false},
+	} {
+		releasePath := filepath.Join(parent, "release-"+tc.failOn)
+		releaseRequest := &models.Release{
+			Type:         models.Registry,
+			Url:          srv.URL,
+			TemplatePath: dir,
+			ReleasePath:  releasePath,
+			Version:      "v1.9",
+			FailOn:       tc.failOn,
+			KeepGoing:    true,
+		}
+		result, err := (&Client{}).Generate(context.Background(), releaseRequest)
+		if errors.Is(err, ErrIncomplete) != tc.incomplete {
+			t.Fatalf("fail-on %q: got %v, want incomplete %v", tc.failOn, err, tc.incomplete)
+		}
+		// 不满足--fail-on时仍生成release目录与release.lock
+		if result == nil {
+			t.Fatalf("fail-on %q: no result", tc.failOn)
+		}
+		status := componentStatus(result.Summary)
+		if status["website"] != StatusSucceeded || status["gateway"] != StatusSkipped || status["auth"] != StatusFailed {
+			t.Fatalf("fail-on %q: got %v", tc.failOn, status)
+		}
+		if _, err := os.Stat(filepath.Join(releasePath, "website.yaml")); err != nil {
+			t.Fatal(err)
+		}
+		for _, component := range []string{"gateway", "auth"} {
+			if _, err := os.Stat(filepath.Join(releasePath, component+".yaml")); !os.IsNotExist(err) {
+				t.Fatalf("fail-on %q: %s.yaml was written: %v", tc.failOn, component, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(releasePath, "release.lock")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
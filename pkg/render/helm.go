@@ -0,0 +1,121 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type chartMeta struct {
+	ApiVersion  string `yaml:"apiVersion"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Version     string `yaml:"version"`
+	AppVersion  string `yaml:"appVersion,omitempty"`
+}
+
+type chartValues struct {
+	Images map[string]string `yaml:"images"`
+}
+
+// 将模板目录生成为helm chart，镜像地址写入values.yaml
+// 模板中{{image}}替换为 {{ index .Values.images "组件名" }}
+func WriteHelmChart(releaseRequest *models.Release, images []*models.ReleaseImage) error {
+	chart := &chartMeta{
+		ApiVersion:  "v2",
+		Name:        releaseRequest.ChartName,
+		Description: "micro-version-management release chart",
+		Type:        "application",
+		Version:     chartVersion(releaseRequest.Version),
+		AppVersion:  releaseRequest.Version,
+	}
+	if err := writeYaml(filepath.Join(releaseRequest.ReleasePath, "Chart.yaml"), chart); err != nil {
+		return err
+	}
+
+	values := &chartValues{Images: map[string]string{}}
+	for _, image := range images {
+		values.Images[image.Component] = image.Image()
+	}
+	if err := writeYaml(filepath.Join(releaseRequest.ReleasePath, "values.yaml"), values); err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		b, err := ioutil.ReadFile(image.TemplateFile)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(releaseRequest.TemplatePath, image.TemplateFile)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(releaseRequest.ReleasePath, "templates", rel)
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+		ref := fmt.Sprintf(`{{ index .Values.images "%s" }}`, image.Component)
+		logger.Info(i18n.T("生成chart模板"), "path", dst)
+		if err := ioutil.WriteFile(dst, []byte(strings.Replace(string(b), "{{image}}", ref, -1)), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	if releaseRequest.Package {
+		archive := filepath.Join(filepath.Dir(filepath.Clean(releaseRequest.ReleasePath)), fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version))
+		logger.Info(i18n.T("打包chart"), "path", archive)
+		if err := packageChart(releaseRequest.ReleasePath, chart.Name, archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var chartVersionRegexp = regexp.MustCompile(`^v?(\d+)(\.\d+)?(\.\d+)?$`)
+
+// helm要求chart版本为semver，v1.9 转换为 1.9.0
+func chartVersion(version string) string {
+	m := chartVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return "0.1.0"
+	}
+	v := m[1]
+	for _, part := range m[2:] {
+		if part == "" {
+			part = ".0"
+		}
+		v += part
+	}
+	return v
+}
+
+func writeYaml(path string, v interface{}) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	logger.Info(i18n.T("生成文件"), "path", path)
+	return ioutil.WriteFile(path, buf.Bytes(), os.ModePerm)
+}
+
+// 打包chart目录，压缩包内顶层目录为chart名称
+func packageChart(chartDir, chartName, archive string) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return utils.TarGz(chartDir, chartName, f)
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type kustomizeImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+type kustomization struct {
+	ApiVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Resources  []string          `yaml:"resources"`
+	Images     []*kustomizeImage `yaml:"images,omitempty"`
+}
+
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// 生成kustomization.yaml，以模板目录为base，images中设置各组件镜像
+// base中的镜像名称为 前缀+组件名，例：moebius/release/website
+// 模板中包含{{image}}或模板目录不是kustomize目录时，在release目录下生成base
+func WriteKustomization(releaseRequest *models.Release, images []*models.ReleaseImage) error {
+	base, err := kustomizeBase(releaseRequest, images)
+	if err != nil {
+		return err
+	}
+
+	k := &kustomization{
+		ApiVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  []string{base},
+	}
+	for _, image := range images {
+		k.Images = append(k.Images, &kustomizeImage{
+			Name:    releaseRequest.Prefix + image.Component,
+			NewName: image.Name,
+			NewTag:  image.Tag,
+			Digest:  image.Digest,
+		})
+	}
+	return writeYaml(filepath.Join(releaseRequest.ReleasePath, "kustomization.yaml"), k)
+}
+
+func kustomizeBase(releaseRequest *models.Release, images []*models.ReleaseImage) (string, error) {
+	placeholder := false
+	for _, image := range images {
+		b, err := ioutil.ReadFile(image.TemplateFile)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(string(b), "{{image}}") {
+			placeholder = true
+			break
+		}
+	}
+	if !placeholder && isKustomizeDir(releaseRequest.TemplatePath) {
+		releasePath, err := filepath.Abs(releaseRequest.ReleasePath)
+		if err != nil {
+			return "", err
+		}
+		templatePath, err := filepath.Abs(releaseRequest.TemplatePath)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(releasePath, templatePath)
+		if err != nil {
+			return "", err
+		}
+		logger.Info(i18n.T("使用模板目录作为kustomize base"), "path", rel)
+		return filepath.ToSlash(rel), nil
+	}
+
+	// 生成base，{{image}}替换为不带tag的镜像名称，由上层kustomization设置tag
+	baseDir := filepath.Join(releaseRequest.ReleasePath, "base")
+	logger.Info(i18n.T("模板目录不能直接作为kustomize base，生成base目录"), "path", baseDir)
+	resources := []string{}
+	for _, image := range images {
+		b, err := ioutil.ReadFile(image.TemplateFile)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(releaseRequest.TemplatePath, image.TemplateFile)
+		if err != nil {
+			return "", err
+		}
+		dst := filepath.Join(baseDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return "", err
+		}
+		content := strings.Replace(string(b), "{{image}}", releaseRequest.Prefix+image.Component, -1)
+		if err := ioutil.WriteFile(dst, []byte(content), os.ModePerm); err != nil {
+			return "", err
+		}
+		resources = append(resources, filepath.ToSlash(rel))
+	}
+	sort.Strings(resources)
+	k := &kustomization{
+		ApiVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  resources,
+	}
+	if err := writeYaml(filepath.Join(baseDir, "kustomization.yaml"), k); err != nil {
+		return "", err
+	}
+	return "base", nil
+}
+
+func isKustomizeDir(dir string) bool {
+	for _, name := range kustomizationFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
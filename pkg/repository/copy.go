@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+)
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type imageManifest struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	MediaType     string        `json:"mediaType"`
+	Config        *descriptor   `json:"config"`
+	Layers        []*descriptor `json:"layers"`
+	Manifests     []*descriptor `json:"manifests"`
+}
+
+// 将镜像从源仓库复制到目标仓库，支持多架构manifest list
+// 目标仓库已存在的blob跳过，同一仓库内优先使用blob挂载
+func CopyImage(ctx context.Context, src *RegistryClient, srcName, reference string, dst *RegistryClient, dstName, dstTag string) error {
+	mediaType, _, body, err := src.GetManifest(ctx, srcName, reference)
+	if err != nil {
+		return err
+	}
+	return copyManifest(ctx, src, srcName, dst, dstName, dstTag, mediaType, body)
+}
+
+func copyManifest(ctx context.Context, src *RegistryClient, srcName string, dst *RegistryClient, dstName, dstReference, mediaType string, body []byte) error {
+	var m imageManifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return err
+	}
+	if mediaType == "" {
+		mediaType = m.MediaType
+	}
+
+	switch mediaType {
+	case MediaTypeManifestList, MediaTypeOCIIndex:
+		// 多架构镜像：先按digest复制各平台manifest，再上传manifest list
+		for _, child := range m.Manifests {
+			childType, _, childBody, err := src.GetManifest(ctx, srcName, child.Digest)
+			if err != nil {
+				return err
+			}
+			if childType == "" {
+				childType = child.MediaType
+			}
+			if err := copyManifest(ctx, src, srcName, dst, dstName, child.Digest, childType, childBody); err != nil {
+				return err
+			}
+		}
+	case MediaTypeManifest, MediaTypeOCIManifest:
+		blobs := append([]*descriptor{m.Config}, m.Layers...)
+		for _, blob := range blobs {
+			if blob == nil {
+				continue
+			}
+			if err := copyBlob(ctx, src, srcName, dst, dstName, blob); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf(i18n.T("不支持的manifest类型：%s"), mediaType)
+	}
+	return dst.PutManifest(ctx, dstName, dstReference, mediaType, body)
+}
+
+func copyBlob(ctx context.Context, src *RegistryClient, srcName string, dst *RegistryClient, dstName string, blob *descriptor) error {
+	exists, err := dst.BlobExists(ctx, dstName, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		logger.Debug(i18n.T("blob已存在，跳过"), "digest", blob.Digest)
+		return nil
+	}
+	if src.Host() == dst.Host() && srcName != dstName {
+		mounted, err := dst.MountBlob(ctx, dstName, blob.Digest, srcName)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			logger.Debug(i18n.T("挂载blob"), "digest", blob.Digest)
+			return nil
+		}
+	}
+	logger.Debug(i18n.T("复制blob"), "digest", blob.Digest)
+	reader, size, err := src.GetBlob(ctx, srcName, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if size < 0 {
+		size = blob.Size
+	}
+	return dst.PushBlob(ctx, dstName, blob.Digest, reader, size)
+}
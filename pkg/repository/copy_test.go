@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 内存中的registry v2仓库，只实现复制镜像用到的接口
+type fakeRegistry struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[string]map[string][]byte // 镜像名称 -> digest -> 内容
+	manifests map[string]map[string][]byte // 镜像名称 -> tag或digest -> 内容
+	types     map[string]string            // digest -> manifest类型
+	uploads   int                          // 普通上传的blob数量
+	mounts    int                          // 挂载的blob数量
+	mount     bool                         // 是否支持跨镜像挂载
+}
+
+func newFakeRegistry(mount bool) *fakeRegistry {
+	r := &fakeRegistry{
+		blobs:     map[string]map[string][]byte{},
+		manifests: map[string]map[string][]byte{},
+		types:     map[string]string{},
+		mount:     mount,
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *fakeRegistry) addBlob(name string, b []byte) *descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blobs[name] == nil {
+		r.blobs[name] = map[string][]byte{}
+	}
+	d := digestOf(b)
+	r.blobs[name][d] = b
+	return &descriptor{MediaType: "application/octet-stream", Digest: d, Size: int64(len(b))}
+}
+
+func (r *fakeRegistry) addManifest(name, reference, mediaType string, b []byte) *descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.manifests[name] == nil {
+		r.manifests[name] = map[string][]byte{}
+	}
+	d := digestOf(b)
+	r.manifests[name][reference] = b
+	r.manifests[name][d] = b
+	r.types[d] = mediaType
+	return &descriptor{MediaType: mediaType, Digest: d, Size: int64(len(b))}
+}
+
+func (r *fakeRegistry) hasBlob(name, digest string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.blobs[name][digest]
+	return ok
+}
+
+func (r *fakeRegistry) manifest(name, reference string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.manifests[name][reference]
+}
+
+// 按/v2/<name>/<kind>/<reference>拆分路径，name可能包含/
+func splitRegistryPath(path string) (string, string, string) {
+	path = strings.TrimPrefix(path, "/v2/")
+	for _, kind := range []string{"/blobs/uploads/", "/manifests/", "/blobs/"} {
+		if i := strings.LastIndex(path, kind); i >= 0 {
+			return path[:i], strings.Trim(kind, "/"), path[i+len(kind):]
+		}
+	}
+	return "", "", ""
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	name, kind, reference := splitRegistryPath(req.URL.Path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case kind == "blobs" && (req.Method == "HEAD" || req.Method == "GET"):
+		b, ok := r.blobs[name][reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		if req.Method == "GET" {
+			_, _ = w.Write(b)
+		}
+	case kind == "blobs/uploads" && req.Method == "POST":
+		if from, digest := req.URL.Query().Get("from"), req.URL.Query().Get("mount"); r.mount && from != "" {
+			if b, ok := r.blobs[from][digest]; ok {
+				if r.blobs[name] == nil {
+					r.blobs[name] = map[string][]byte{}
+				}
+				r.blobs[name][digest] = b
+				r.mounts++
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/session")
+		w.WriteHeader(http.StatusAccepted)
+	case kind == "blobs/uploads" && req.Method == "PUT":
+		b, _ := ioutil.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if digestOf(b) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.blobs[name] == nil {
+			r.blobs[name] = map[string][]byte{}
+		}
+		r.blobs[name][digest] = b
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case kind == "blobs/uploads" && req.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+	case kind == "manifests" && (req.Method == "HEAD" || req.Method == "GET"):
+		b, ok := r.manifests[name][reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[digestOf(b)])
+		w.Header().Set("Docker-Content-Digest", digestOf(b))
+		if req.Method == "GET" {
+			_, _ = w.Write(b)
+		}
+	case kind == "manifests" && req.Method == "PUT":
+		b, _ := ioutil.ReadAll(req.Body)
+		var m imageManifest
+		_ = json.Unmarshal(b, &m)
+		// 与真实仓库一致，引用的blob与子manifest必须已存在
+		for _, blob := range append([]*descriptor{m.Config}, m.Layers...) {
+			if blob == nil {
+				continue
+			}
+			if _, ok := r.blobs[name][blob.Digest]; !ok {
+				http.Error(w, "blob unknown: "+blob.Digest, http.StatusBadRequest)
+				return
+			}
+		}
+		for _, child := range m.Manifests {
+			if _, ok := r.manifests[name][child.Digest]; !ok {
+				http.Error(w, "manifest unknown: "+child.Digest, http.StatusBadRequest)
+				return
+			}
+		}
+		if r.manifests[name] == nil {
+			r.manifests[name] = map[string][]byte{}
+		}
+		r.manifests[name][reference] = b
+		r.manifests[name][digestOf(b)] = b
+		r.types[digestOf(b)] = req.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// 在仓库中添加一个单平台镜像，返回manifest描述
+func addImage(r *fakeRegistry, name, reference, platform string) (*descriptor, *descriptor, *descriptor) {
+	config := r.addBlob(name, []byte(`{"architecture":"`+platform+`"}`))
+	layer := r.addBlob(name, []byte("layer-"+platform))
+	b, _ := json.Marshal(&imageManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        config,
+		Layers:        []*descriptor{layer},
+	})
+	return r.addManifest(name, reference, MediaTypeManifest, b), config, layer
+}
+
+func TestCopyImageSkipsExistingBlobs(t *testing.T) {
+	src, dst := newFakeRegistry(true), newFakeRegistry(true)
+	defer src.Close()
+	defer dst.Close()
+	_, config, layer := addImage(src, "moebius/release/website", "v1.9-10", "amd64")
+	// 目标仓库已有config，只需上传layer
+	dst.addBlob("prod/website", []byte(`{"architecture":"amd64"}`))
+
+	err := CopyImage(context.Background(), NewRegistryClient(src.URL), "moebius/release/website", "v1.9-10", NewRegistryClient(dst.URL), "prod/website", "v1.9-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.uploads != 1 || dst.mounts != 0 {
+		t.Fatalf("uploads=%d mounts=%d, want 1 upload and no mount", dst.uploads, dst.mounts)
+	}
+	if !dst.hasBlob("prod/website", config.Digest) || !dst.hasBlob("prod/website", layer.Digest) {
+		t.Fatal("target is missing blobs")
+	}
+	if string(dst.manifest("prod/website", "v1.9-10")) != string(src.manifest("moebius/release/website", "v1.9-10")) {
+		t.Fatal("target manifest differs from source")
+	}
+}
+
+func TestCopyImageMountsBlobsInSameRegistry(t *testing.T) {
+	r := newFakeRegistry(true)
+	defer r.Close()
+	_, config, layer := addImage(r, "moebius/release/website", "v1.9-10", "amd64")
+
+	client := NewRegistryClient(r.URL)
+	if err := CopyImage(context.Background(), client, "moebius/release/website", "v1.9-10", client, "prod/website", "v1.9-10"); err != nil {
+		t.Fatal(err)
+	}
+	if r.uploads != 0 || r.mounts != 2 {
+		t.Fatalf("uploads=%d mounts=%d, want 2 mounts and no upload", r.uploads, r.mounts)
+	}
+	if !r.hasBlob("prod/website", config.Digest) || !r.hasBlob("prod/website", layer.Digest) {
+		t.Fatal("target is missing blobs")
+	}
+}
+
+func TestCopyImageFallsBackWhenMountUnsupported(t *testing.T) {
+	r := newFakeRegistry(false)
+	defer r.Close()
+	addImage(r, "moebius/release/website", "v1.9-10", "amd64")
+
+	client := NewRegistryClient(r.URL)
+	if err := CopyImage(context.Background(), client, "moebius/release/website", "v1.9-10", client, "prod/website", "v1.9-10"); err != nil {
+		t.Fatal(err)
+	}
+	if r.uploads != 2 || r.mounts != 0 {
+		t.Fatalf("uploads=%d mounts=%d, want 2 uploads", r.uploads, r.mounts)
+	}
+}
+
+func TestCopyImageManifestList(t *testing.T) {
+	src, dst := newFakeRegistry(true), newFakeRegistry(true)
+	defer src.Close()
+	defer dst.Close()
+	amd64, _, _ := addImage(src, "moebius/release/website", "amd64", "amd64")
+	arm64, _, _ := addImage(src, "moebius/release/website", "arm64", "arm64")
+	b, _ := json.Marshal(&imageManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifestList,
+		Manifests:     []*descriptor{amd64, arm64},
+	})
+	list := src.addManifest("moebius/release/website", "v1.9-10", MediaTypeManifestList, b)
+
+	err := CopyImage(context.Background(), NewRegistryClient(src.URL), "moebius/release/website", "v1.9-10", NewRegistryClient(dst.URL), "prod/website", "v1.9-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*descriptor{amd64, arm64, list} {
+		if dst.manifest("prod/website", d.Digest) == nil {
+			t.Fatalf("target is missing manifest %s", d.Digest)
+		}
+	}
+	if dst.uploads != 4 {
+		t.Fatalf("uploads=%d, want 4", dst.uploads)
+	}
+	mediaType, digest, _, err := NewRegistryClient(dst.URL).GetManifest(context.Background(), "prod/website", "v1.9-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeManifestList || digest != list.Digest {
+		t.Fatalf("got %s %s, want manifest list %s", mediaType, digest, list.Digest)
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"net/http"
+)
+
+// 删除harbor镜像tag
+func HarborDeleteTag(ctx context.Context, searchRequest *models.Search, tag *models.ImageTags) error {
+	userName, password, url := spiltLink(searchRequest.Url)
+	deleteUrl := fmt.Sprintf("%s/api/repositories/%s/tags/%s", url, searchRequest.Name, tag.ImageTag)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(userName, password)
+	return doDelete(ctx, models.Harbor, req)
+}
+
+// 删除nexus镜像组件，组件id来源于搜索结果
+func NexusDeleteTag(ctx context.Context, searchRequest *models.Search, tag *models.ImageTags) error {
+	if tag.Id == "" {
+		return errors.New(i18n.T("nexus组件id为空：%s", tag.ImageName+":"+tag.ImageTag))
+	}
+	userName, password, url := spiltLink(searchRequest.Url)
+	cookie, err := nexusLogin(ctx, url, userName, password)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/service/rest/v1/components/%s", url, tag.Id), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Cookie", cookie)
+	return doDelete(ctx, models.Nexus, req)
+}
+
+// 删除registry v2镜像tag，需先查询tag对应的manifest digest
+// 注意：删除digest会同时删除指向该digest的其他tag
+func RegistryDeleteTag(ctx context.Context, searchRequest *models.Search, tag *models.ImageTags) error {
+	client := NewRegistryClient(searchRequest.Url)
+	digest := tag.Digest
+	if digest == "" {
+		d, err := client.ManifestDigest(ctx, searchRequest.Name, tag.ImageTag)
+		if err != nil {
+			return err
+		}
+		digest = d
+	}
+	return client.DeleteManifest(ctx, searchRequest.Name, digest)
+}
+
+func doDelete(ctx context.Context, backend string, req *http.Request) error {
+	resp, err := doRequest(newClient(), backend, "delete", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// 下载插件等文件写入w，内容可能很大，不限制整体时间
+// 下载的内容会被执行，始终校验证书，不受--insecure-registry影响
+func Download(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(&http.Client{Transport: transport}, "plugin", "download", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
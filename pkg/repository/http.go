@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/metrics"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	url2 "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 单次请求超时时间，包括读取响应内容；blob传输只限制等待响应头的时间
+var timeout = 30 * time.Second
+
+// 请求未完成、返回5xx或429时的最大重试次数
+var retries = 3
+
+// 重试间隔，按1s、2s、4s...递增，429时优先使用Retry-After
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// 所有仓库共用的transport，校验证书
+var transport = newTransport(nil)
+
+// --insecure-registry指定的仓库使用的transport，跳过证书校验
+var insecureTransport = newTransport(&tls.Config{InsecureSkipVerify: true})
+
+// 跳过证书校验的仓库地址，host[:port]
+var insecureHosts = map[string]bool{}
+
+func newTransport(config *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       config,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// 设置请求超时时间与重试次数，需在发送请求前调用
+func Configure(requestTimeout time.Duration, maxRetries int) {
+	timeout = requestTimeout
+	retries = maxRetries
+	transport.ResponseHeaderTimeout = requestTimeout
+	insecureTransport.ResponseHeaderTimeout = requestTimeout
+}
+
+// 设置跳过证书校验的仓库，用于自签名证书的nexus/harbor，地址可以是host[:port]或完整url
+func SetInsecureRegistries(registries []string) {
+	insecureHosts = map[string]bool{}
+	for _, r := range registries {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if u, err := url2.Parse(r); err == nil && u.Host != "" {
+			r = u.Host
+		}
+		insecureHosts[strings.ToLower(r)] = true
+	}
+}
+
+// 按请求地址选择transport，重定向到其他地址时重新选择
+type registryTransport struct{}
+
+func (registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if insecureHosts[strings.ToLower(req.URL.Host)] {
+		return insecureTransport.RoundTrip(req)
+	}
+	return transport.RoundTrip(req)
+}
+
+// 普通请求使用的client
+func newClient() *http.Client {
+	return &http.Client{Transport: registryTransport{}, Timeout: timeout}
+}
+
+// blob上传下载使用的client，内容可能很大，不限制整体时间
+func newStreamClient() *http.Client {
+	return &http.Client{Transport: registryTransport{}}
+}
+
+// 镜像仓库返回非2xx时的错误，包含仓库返回的错误内容
+type HTTPError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s %s: %s", e.Method, e.Url, e.Status)
+	}
+	return fmt.Sprintf("%s %s: %s %s", e.Method, e.Url, e.Status, e.Body)
+}
+
+// 读取响应内容生成错误，内容过长时截断
+func newHTTPError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	u := *resp.Request.URL
+	u.User = nil
+	u.RawQuery = ""
+	return &HTTPError{
+		Method:     resp.Request.Method,
+		Url:        u.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// 状态码不为2xx时返回错误
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	return newHTTPError(resp)
+}
+
+// 发送请求并记录指标，backend为仓库类型，endpoint为接口名称
+// 请求未完成、返回5xx或429时重试，请求内容不可重复读取或请求已取消时不重试
+func doRequest(client *http.Client, backend, endpoint string, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := client.Do(req)
+		metrics.ObserveRequest(backend, endpoint, resp, err, time.Since(start))
+
+		delay, retry := retryDelay(resp, err, attempt)
+		if !retry || attempt >= retries || (req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if err != nil {
+			logger.Warn(i18n.T("请求失败，稍后重试"), "delay", delay, "error", err)
+		} else {
+			logger.Warn(i18n.T("请求失败，稍后重试"), "method", req.Method, "path", req.URL.Path, "status", resp.Status, "delay", delay)
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// 计算重试间隔，返回是否需要重试
+func retryDelay(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	delay := retryBaseDelay << uint(attempt)
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	if err != nil {
+		return delay, true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if after > retryMaxDelay {
+				after = retryMaxDelay
+			}
+			return after, true
+		}
+		return delay, true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return delay, true
+	}
+	return 0, false
+}
+
+// Retry-After 为秒数或http时间
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryVerifiesCertificates(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tags":["v1.9-1"]}`))
+	}))
+	defer srv.Close()
+	defer SetInsecureRegistries(nil)
+	// 证书错误不重试
+	defer Configure(timeout, retries)
+	Configure(timeout, 0)
+
+	SetInsecureRegistries(nil)
+	if _, err := NewRegistryClient(srv.URL).Tags(context.Background(), "website"); err == nil {
+		t.Fatal("expected a certificate error for a self-signed registry")
+	}
+
+	SetInsecureRegistries([]string{srv.URL})
+	tags, err := NewRegistryClient(srv.URL).Tags(context.Background(), "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "v1.9-1" {
+		t.Fatalf("got %v", tags)
+	}
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/cache"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
+	url2 "net/url"
+	"path/filepath"
+	"strings"
+)
+
+// 来源名称，未配置时为去掉用户名密码的地址
+func PluginSourceName(source *models.PluginSource) string {
+	if source.Name != "" {
+		return source.Name
+	}
+	if u, err := url2.Parse(source.Url); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+	return source.Url
+}
+
+// 是否为http/https来源，其余为本地文件或目录
+func IsHTTPSource(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// 读取单个插件列表，http来源在缓存有效期内使用缓存，过期后按ETag/Last-Modified条件请求，查询失败时使用过期的缓存
+func PluginIndex(ctx context.Context, source *models.PluginSource, c *cache.IndexCache) (*models.PluginList, error) {
+	if !IsHTTPSource(source.Url) {
+		b, err := ioutil.ReadFile(strings.TrimPrefix(source.Url, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		return DecodePluginIndex(b)
+	}
+	b, err := fetchPluginIndex(ctx, source, c)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePluginIndex(b)
+}
+
+func fetchPluginIndex(ctx context.Context, source *models.PluginSource, c *cache.IndexCache) ([]byte, error) {
+	entry, fresh := c.Get(source)
+	if fresh {
+		logger.Debug(i18n.T("使用缓存的插件列表"), "source", PluginSourceName(source))
+		return entry.Body, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", source.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/yaml;q=0.9, */*;q=0.8")
+	if source.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+source.Token)
+	} else if source.Username != "" {
+		req.SetBasicAuth(source.Username, source.Password)
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	// 只有网络错误或5xx时使用过期的缓存，401/403等说明凭据或权限有误，不降级
+	unavailable := false
+	body, err := func() ([]byte, error) {
+		resp, err := doRequest(newClient(), "plugin", "index", req)
+		if err != nil {
+			unavailable = true
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotModified && entry != nil {
+			if err := c.Put(source, entry); err != nil {
+				logger.Warn(i18n.T("写入插件列表缓存失败"), "error", err)
+			}
+			return entry.Body, nil
+		}
+		if err := checkResponse(resp); err != nil {
+			unavailable = resp.StatusCode >= 500
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			unavailable = true
+			return nil, err
+		}
+		// 只缓存能解析的插件列表
+		if _, err := DecodePluginIndex(body); err != nil {
+			return nil, err
+		}
+		err = c.Put(source, &cache.IndexEntry{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Body:         body,
+		})
+		if err != nil {
+			logger.Warn(i18n.T("写入插件列表缓存失败"), "error", err)
+		}
+		return body, nil
+	}()
+	if err != nil && unavailable && entry != nil && c.Usable(entry) && ctx.Err() == nil {
+		logger.Warn(i18n.T("查询插件列表失败，使用过期的缓存"), "source", PluginSourceName(source), "updated", entry.Updated, "error", err)
+		return entry.Body, nil
+	}
+	return body, err
+}
+
+// 解析json或yaml格式的插件列表
+func DecodePluginIndex(b []byte) (*models.PluginList, error) {
+	b, err := PluginIndexJson(b)
+	if err != nil {
+		return nil, err
+	}
+	list := &models.PluginList{}
+	if err := json.Unmarshal(b, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// 将yaml格式的插件列表转换为json，json格式原样返回
+// 插件列表中的值都是字符串，yaml中的标量按原文转换为字符串，版本号1.10不会被解析为数字1.1
+func PluginIndexJson(b []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		return b, nil
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, err
+	}
+	return json.Marshal(yamlValue(&node))
+}
+
+func yamlValue(n *yaml.Node) interface{} {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return yamlValue(n.Content[0])
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			m[n.Content[i].Value] = yamlValue(n.Content[i+1])
+		}
+		return m
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			s = append(s, yamlValue(c))
+		}
+		return s
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	}
+	if n.Tag == "!!null" {
+		return nil
+	}
+	return n.Value
+}
+
+// 按文件扩展名输出json或yaml格式的插件列表
+func EncodePluginIndex(list *models.PluginList, path string) ([]byte, error) {
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(v)
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"github.com/antmoveh/micro-version-management/pkg/cache"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+const testPluginIndex = `{"plugins":[{"name":"mysql","versions":[{"version":"1.2.0-3_x86","download-url":"http://example.com/mysql.tgz"}]}]}`
+
+// 插件列表地址，status不为200时返回该状态码
+type indexServer struct {
+	*httptest.Server
+	status int
+}
+
+func newIndexServer() *indexServer {
+	s := &indexServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		_, _ = w.Write([]byte(testPluginIndex))
+	}))
+	return s
+}
+
+// 缓存立即过期，每次查询都请求插件列表地址
+func newExpiredIndexCache(t *testing.T) *cache.IndexCache {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache.NewIndexCache(dir, time.Nanosecond)
+}
+
+func TestPluginIndexStaleFallback(t *testing.T) {
+	defer Configure(timeout, retries)
+	Configure(timeout, 0)
+	cases := []struct {
+		status   int
+		maxStale time.Duration
+		fallback bool
+	}{
+		{http.StatusServiceUnavailable, time.Hour, true},
+		{http.StatusUnauthorized, time.Hour, false},
+		{http.StatusForbidden, time.Hour, false},
+		{http.StatusNotFound, time.Hour, false},
+		// 缓存过期太久时不再降级
+		{http.StatusServiceUnavailable, time.Nanosecond, false},
+	}
+	for _, tc := range cases {
+		s := newIndexServer()
+		c := newExpiredIndexCache(t)
+		c.MaxStale = tc.maxStale
+		source := &models.PluginSource{Url: s.URL + "/index.json"}
+		if _, err := PluginIndex(context.Background(), source, c); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+
+		s.status = tc.status
+		list, err := PluginIndex(context.Background(), source, c)
+		if tc.fallback && (err != nil || len(list.Plugins) != 1) {
+			t.Errorf("status %d: expected the stale cache, got %v", tc.status, err)
+		}
+		if !tc.fallback && err == nil {
+			t.Errorf("status %d, max stale %s: expected an error", tc.status, tc.maxStale)
+		}
+		s.Close()
+		os.RemoveAll(c.Dir)
+	}
+}
+
+func TestPluginIndexFallbackOnNetworkError(t *testing.T) {
+	defer Configure(timeout, retries)
+	Configure(timeout, 0)
+	s := newIndexServer()
+	c := newExpiredIndexCache(t)
+	defer os.RemoveAll(c.Dir)
+	source := &models.PluginSource{Url: s.URL + "/index.json"}
+	if _, err := PluginIndex(context.Background(), source, c); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := PluginIndex(context.Background(), source, c); err != nil {
+		t.Fatalf("expected the stale cache, got %v", err)
+	}
+}
+
+func TestPluginIndexCacheKeyedByCredentials(t *testing.T) {
+	s := newIndexServer()
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := cache.NewIndexCache(dir+"/cache", time.Hour)
+
+	source := &models.PluginSource{Url: s.URL + "/index.json", Token: "a"}
+	if _, err := PluginIndex(context.Background(), source, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, fresh := c.Get(source); !fresh {
+		t.Fatal("expected a cached index for the same token")
+	}
+	for _, other := range []*models.PluginSource{
+		{Url: source.Url},
+		{Url: source.Url, Token: "b"},
+		{Url: source.Url, Username: "admin", Password: "a"},
+	} {
+		if entry, _ := c.Get(other); entry != nil {
+			t.Fatalf("cache for token a was returned for %+v", other)
+		}
+	}
+
+	info, err := os.Stat(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("cache dir mode %s, want 0700", info.Mode().Perm())
+	}
+	files, _ := ioutil.ReadDir(c.Dir)
+	for _, f := range files {
+		if f.Mode().Perm() != 0600 {
+			t.Fatalf("cache file %s mode %s, want 0600", f.Name(), f.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	url2 "net/url"
+	"regexp"
+	"strings"
+)
+
+// manifest类型
+const (
+	MediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestAccept = strings.Join([]string{MediaTypeManifestList, MediaTypeOCIIndex, MediaTypeManifest, MediaTypeOCIManifest}, ", ")
+
+// registry v2 API客户端，支持basic认证与bearer token认证
+type RegistryClient struct {
+	Url      string // 仓库地址，不含用户名密码
+	userName string
+	password string
+	client   *http.Client
+	stream   *http.Client      // blob上传下载
+	tokens   map[string]string // 镜像名称 -> bearer token
+}
+
+func NewRegistryClient(link string) *RegistryClient {
+	userName, password, url := spiltLink(link)
+	return &RegistryClient{
+		Url:      url,
+		userName: userName,
+		password: password,
+		client:   newClient(),
+		stream:   newStreamClient(),
+		tokens:   map[string]string{},
+	}
+}
+
+// 仓库地址中的host，用于判断两个仓库是否为同一仓库
+func (c *RegistryClient) Host() string {
+	u, err := url2.Parse(c.Url)
+	if err != nil {
+		return c.Url
+	}
+	return u.Host
+}
+
+// 发送请求，收到bearer认证质询时获取token后重试
+// body需可重复读取，上传大文件时先由无body请求完成认证
+func (c *RegistryClient) do(ctx context.Context, name string, method string, url string, header http.Header, body []byte) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		c.authorize(name, req)
+		endpoint := registryEndpoint(method, url)
+		client := c.client
+		if endpoint == "GET blobs" {
+			client = c.stream
+		}
+		return doRequest(client, models.Registry, endpoint, req)
+	}
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, errors.New(i18n.T("镜像仓库认证失败：%s", url))
+	}
+	if err := c.fetchToken(ctx, name, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+func (c *RegistryClient) authorize(name string, req *http.Request) {
+	if token, ok := c.tokens[name]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if c.userName != "" {
+		req.SetBasicAuth(c.userName, c.password)
+	}
+}
+
+var challengeRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// 根据WWW-Authenticate质询获取bearer token，scope固定为该镜像pull,push
+func (c *RegistryClient) fetchToken(ctx context.Context, name string, challenge string) error {
+	params := map[string]string{}
+	for _, m := range challengeRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return errors.New(i18n.T("镜像仓库认证质询不正确：%s", challenge))
+	}
+	q := url2.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull,push", name))
+	req, err := http.NewRequestWithContext(ctx, "GET", params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.userName != "" {
+		req.SetBasicAuth(c.userName, c.password)
+	}
+	resp, err := doRequest(c.client, models.Registry, "token", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return fmt.Errorf(i18n.T("获取镜像仓库token失败：%w"), err)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	c.tokens[name] = token.Token
+	return nil
+}
+
+// 指标中的接口名称，例：GET manifests，镜像名称可能包含/，取/v2/之后最后一个接口关键字
+func registryEndpoint(method, url string) string {
+	path := url
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	endpoint := "other"
+	for _, part := range strings.Split(path, "/") {
+		switch part {
+		case "manifests", "tags", "blobs":
+			endpoint = part
+		case "uploads":
+			endpoint = "blobs/uploads"
+		}
+	}
+	return method + " " + endpoint
+}
+
+// 查询镜像所有tag，支持Link分页
+func (c *RegistryClient) Tags(ctx context.Context, name string) ([]string, error) {
+	tags := []string{}
+	next := fmt.Sprintf("%s/v2/%s/tags/list", c.Url, name)
+	for next != "" {
+		resp, err := c.do(ctx, name, "GET", next, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		// 镜像不存在时返回空列表，与其他仓库类型保持一致
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return tags, nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := newHTTPError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		next = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			start, end := strings.Index(link, "<"), strings.Index(link, ">")
+			if start >= 0 && end > start {
+				next = c.Url + link[start+1:end]
+			}
+		}
+	}
+	return tags, nil
+}
+
+// 获取manifest，返回类型、digest与内容
+func (c *RegistryClient) GetManifest(ctx context.Context, name, reference string) (string, string, []byte, error) {
+	header := http.Header{"Accept": []string{manifestAccept}}
+	resp, err := c.do(ctx, name, "GET", fmt.Sprintf("%s/v2/%s/manifests/%s", c.Url, name, reference), header, nil)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", nil, newHTTPError(resp)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return resp.Header.Get("Content-Type"), resp.Header.Get("Docker-Content-Digest"), body, nil
+}
+
+// 查询tag对应的manifest digest
+func (c *RegistryClient) ManifestDigest(ctx context.Context, name, reference string) (string, error) {
+	header := http.Header{"Accept": []string{manifestAccept}}
+	resp, err := c.do(ctx, name, "HEAD", fmt.Sprintf("%s/v2/%s/manifests/%s", c.Url, name, reference), header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", newHTTPError(resp)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.New(i18n.T("镜像仓库未返回manifest digest：%s", name+":"+reference))
+	}
+	return digest, nil
+}
+
+// manifest是否存在，不存在时返回false
+func (c *RegistryClient) ManifestExists(ctx context.Context, name, reference string) (bool, error) {
+	_, err := c.ManifestDigest(ctx, name, reference)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// 按digest删除manifest
+func (c *RegistryClient) DeleteManifest(ctx context.Context, name, digest string) error {
+	resp, err := c.do(ctx, name, "DELETE", fmt.Sprintf("%s/v2/%s/manifests/%s", c.Url, name, digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return newHTTPError(resp)
+	}
+	return nil
+}
+
+// 上传manifest，reference为tag或digest
+func (c *RegistryClient) PutManifest(ctx context.Context, name, reference, mediaType string, body []byte) error {
+	header := http.Header{"Content-Type": []string{mediaType}}
+	resp, err := c.do(ctx, name, "PUT", fmt.Sprintf("%s/v2/%s/manifests/%s", c.Url, name, reference), header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return newHTTPError(resp)
+	}
+	return nil
+}
+
+// 判断blob是否已存在
+func (c *RegistryClient) BlobExists(ctx context.Context, name, digest string) (bool, error) {
+	resp, err := c.do(ctx, name, "HEAD", fmt.Sprintf("%s/v2/%s/blobs/%s", c.Url, name, digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, newHTTPError(resp)
+}
+
+// 下载blob，调用方负责关闭
+func (c *RegistryClient) GetBlob(ctx context.Context, name, digest string) (io.ReadCloser, int64, error) {
+	resp, err := c.do(ctx, name, "GET", fmt.Sprintf("%s/v2/%s/blobs/%s", c.Url, name, digest), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, newHTTPError(resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// 从同一仓库的其他镜像挂载blob，仓库不支持挂载时返回false
+func (c *RegistryClient) MountBlob(ctx context.Context, name, digest, from string) (bool, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/uploads/?mount=%s&from=%s", c.Url, name, url2.QueryEscape(digest), url2.QueryEscape(from))
+	resp, err := c.do(ctx, name, "POST", url, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// 仓库开启了普通上传会话，取消该会话后走普通上传
+		if location := resp.Header.Get("Location"); location != "" {
+			if del, err := c.do(ctx, name, "DELETE", c.resolve(location), nil, nil); err == nil {
+				del.Body.Close()
+			}
+		}
+		return false, nil
+	}
+	return false, newHTTPError(resp)
+}
+
+// 整体上传blob：先POST开启上传会话，再PUT上传内容
+func (c *RegistryClient) PushBlob(ctx context.Context, name, digest string, blob io.Reader, size int64) error {
+	resp, err := c.do(ctx, name, "POST", fmt.Sprintf("%s/v2/%s/blobs/uploads/", c.Url, name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return newHTTPError(resp)
+	}
+	location := c.resolve(resp.Header.Get("Location"))
+	if strings.Contains(location, "?") {
+		location += "&digest=" + url2.QueryEscape(digest)
+	} else {
+		location += "?digest=" + url2.QueryEscape(digest)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", location, blob)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	c.authorize(name, req)
+	resp, err = doRequest(c.stream, models.Registry, registryEndpoint("PUT", location), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return newHTTPError(resp)
+	}
+	return nil
+}
+
+// Location可能为相对路径
+func (c *RegistryClient) resolve(location string) string {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location
+	}
+	return c.Url + location
+}
+
+// registry v2 仓库镜像tag列表
+func RegistryTags(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
+	client := NewRegistryClient(searchRequest.Url)
+	tags, err := client.Tags(ctx, searchRequest.Name)
+	if err != nil {
+		return nil, err
+	}
+	var it []*models.ImageTags
+	for _, t := range tags {
+		it = append(it, &models.ImageTags{
+			ImageName: searchRequest.Name,
+			ImageTag:  t,
+			Source:    models.Registry,
+		})
+	}
+	return it, nil
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManifestExists(t *testing.T) {
+	r := newFakeRegistry(true)
+	defer r.Close()
+	addImage(r, "moebius/release/website", "v1.9-10", "amd64")
+	client := NewRegistryClient(r.URL)
+
+	exists, err := client.ManifestExists(context.Background(), "moebius/release/website", "v1.9-10")
+	if err != nil || !exists {
+		t.Fatalf("got %v, %v, want an existing tag", exists, err)
+	}
+	exists, err = client.ManifestExists(context.Background(), "moebius/release/website", "v1.9-11")
+	if err != nil || exists {
+		t.Fatalf("got %v, %v, want a missing tag", exists, err)
+	}
+}
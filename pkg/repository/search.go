@@ -1,31 +1,47 @@
 package repository
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
 	"github.com/antmoveh/micro-version-management/pkg/models"
 	"io/ioutil"
 	"net/http"
 	url2 "net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
-func DockerHubTags(searchRequest *models.Search) ([]*models.ImageTags, error) {
+func DockerHubTags(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
 	url := fmt.Sprintf("https://registry.hub.docker.com/v2/repositories/library/%s/tags?page_size=100&&page=1", searchRequest.Name)
-	resp, err := http.Get(url)
-	defer resp.Body.Close()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(newClient(), models.DockerHub, "tags", req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.New(i18n.T("未能找到匹配镜像"))
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
 	var tags models.DockerHubTags
 
 	if err := json.Unmarshal(body, &tags); err != nil {
-		return nil, errors.New("未能找到匹配镜像")
+		return nil, errors.New(i18n.T("未能找到匹配镜像"))
 	}
 	var it []*models.ImageTags
 	for _, t := range tags.Results {
@@ -38,45 +54,38 @@ func DockerHubTags(searchRequest *models.Search) ([]*models.ImageTags, error) {
 	return it, nil
 }
 
-func NexusSearchTags(searchRequest *models.Search) ([]*models.ImageTags, error) {
+func NexusSearchTags(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
 
 	userName, password, url := spiltLink(searchRequest.Url)
 
 	tagUrl := fmt.Sprintf("%s/service/rest/v1/search?docker.imageName=%s", url, searchRequest.Name)
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-
-	cookie := ""
-	if userName != "" && password != "" {
-		loginUrl := fmt.Sprintf("%s/service/rapture/session", url)
+	client := newClient()
 
-		data := make(url2.Values)
-		data["username"] = []string{base64.StdEncoding.EncodeToString([]byte(userName))}
-		data["password"] = []string{base64.StdEncoding.EncodeToString([]byte(password))}
-		resp1, err := http.PostForm(loginUrl, data)
-		if err != nil {
-			return nil, err
-		}
-		defer resp1.Body.Close()
-		cookie = resp1.Header.Get("Set-Cookie")
+	cookie, err := nexusLogin(ctx, url, userName, password)
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", tagUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", tagUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Cookie", cookie)
 
-	resp, err := client.Do(req)
+	resp, err := doRequest(client, models.Nexus, "search", req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
 	var tags models.NexusTags
 
@@ -85,37 +94,100 @@ func NexusSearchTags(searchRequest *models.Search) ([]*models.ImageTags, error)
 	}
 	var it []*models.ImageTags
 	for _, t := range tags.Items {
+		// docker组件的asset即为manifest，其sha256与镜像digest一致
+		digest := ""
+		if len(t.Assets) > 0 && t.Assets[0].Checksum.Sha256 != "" {
+			digest = "sha256:" + t.Assets[0].Checksum.Sha256
+		}
 		it = append(it, &models.ImageTags{
 			ImageName: searchRequest.Name,
 			ImageTag:  t.Version,
+			Digest:    digest,
+			Id:        t.Id,
 			Source:    models.Nexus,
 		})
 	}
 	return it, nil
 }
 
-func HarborTags(searchRequest *models.Search) ([]*models.ImageTags, error) {
+// nexus会话cookie，同一进程内复用，避免每次查询都登录
+type nexusSession struct {
+	cookie  string
+	created time.Time
+}
+
+// nexus默认会话超时为30分钟，提前重新登录
+const nexusSessionTTL = 10 * time.Minute
+
+var (
+	nexusSessionsMu sync.Mutex
+	nexusSessions   = map[string]*nexusSession{}
+)
+
+// nexus登录，返回会话cookie，未配置用户名密码时返回空
+func nexusLogin(ctx context.Context, url, userName, password string) (string, error) {
+	if userName == "" || password == "" {
+		return "", nil
+	}
+	sessionKey := url + "\n" + userName + "\n" + password
+	nexusSessionsMu.Lock()
+	session, ok := nexusSessions[sessionKey]
+	nexusSessionsMu.Unlock()
+	if ok && time.Since(session.created) < nexusSessionTTL {
+		return session.cookie, nil
+	}
+	loginUrl := fmt.Sprintf("%s/service/rapture/session", url)
+
+	data := make(url2.Values)
+	data["username"] = []string{base64.StdEncoding.EncodeToString([]byte(userName))}
+	data["password"] = []string{base64.StdEncoding.EncodeToString([]byte(password))}
+	req, err := http.NewRequestWithContext(ctx, "POST", loginUrl, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := doRequest(newClient(), models.Nexus, "login", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return "", fmt.Errorf(i18n.T("nexus登录失败：%w"), err)
+	}
+	cookie := resp.Header.Get("Set-Cookie")
+	if cookie != "" {
+		nexusSessionsMu.Lock()
+		nexusSessions[sessionKey] = &nexusSession{cookie: cookie, created: time.Now()}
+		nexusSessionsMu.Unlock()
+	}
+	return cookie, nil
+}
+
+func HarborTags(ctx context.Context, searchRequest *models.Search) ([]*models.ImageTags, error) {
 	userName, password, url := spiltLink(searchRequest.Url)
 	tagUrl := fmt.Sprintf("%s/api/repositories/%s/tags?detail=false", url, searchRequest.Name)
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
+	client := newClient()
 
-	req, err := http.NewRequest("GET", tagUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", tagUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.SetBasicAuth(userName, password)
 	//req.Header.Add("Cookie", cookie)
-	resp, err := client.Do(req)
+	resp, err := doRequest(client, models.Harbor, "tags", req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
 	var tags []*models.HarborTag
 
@@ -127,6 +199,7 @@ func HarborTags(searchRequest *models.Search) ([]*models.ImageTags, error) {
 		it = append(it, &models.ImageTags{
 			ImageName: searchRequest.Name,
 			ImageTag:  t.Name,
+			Digest:    t.Digest,
 			Source:    models.Harbor,
 		})
 	}
@@ -147,32 +220,7 @@ func spiltLink(url string) (string, string, string) {
 	}
 }
 
-func PluginSearch(searchRequest *models.PluginSearch) (*models.PluginList, error) {
-	tagUrl := searchRequest.Url
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-
-	req, err := http.NewRequest("GET", tagUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-
-	var tags models.PluginList
-
-	if err := json.Unmarshal(body, &tags); err != nil {
-		return nil, err
-	}
-
-	return &tags, nil
+// 查询单个插件列表地址，不使用缓存
+func PluginSearch(ctx context.Context, searchRequest *models.PluginSearch) (*models.PluginList, error) {
+	return PluginIndex(ctx, &models.PluginSource{Url: searchRequest.Url}, nil)
 }
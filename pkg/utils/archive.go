@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 将目录打包为tar.gz写入w，压缩包内顶层目录为top
+func TarGz(dir, top string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = top + "/" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// 压缩包内的文件路径不能为绝对路径或跳出解压目录
+func safeJoin(dir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || strings.HasPrefix(name, string(filepath.Separator)) {
+		return "", errors.New(i18n.T("压缩包内文件路径不安全：%s", name))
+	}
+	path := filepath.Join(dir, name)
+	if path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", errors.New(i18n.T("压缩包内文件路径不安全：%s", name))
+	}
+	return path, nil
+}
+
+// 解压tar.gz到dir，只支持普通文件与目录
+// 不支持符号链接：已解压的链接会被之后的文件路径跟随，只检查链接目标无法阻止写到dir之外
+func ExtractTarGz(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := safeJoin(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(path, tr, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return errors.New(i18n.T("压缩包内不支持符号链接：%s", hdr.Name))
+		default:
+			return errors.New(i18n.T("压缩包内文件类型不支持：%s", hdr.Name))
+		}
+	}
+}
+
+// 解压zip到dir，只支持普通文件与目录
+func ExtractZip(path, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		dst, err := safeJoin(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			src, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = writeFile(dst, src, mode)
+			src.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.New(i18n.T("压缩包内文件类型不支持：%s", f.Name))
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 不跟随已存在的符号链接
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return errors.New(i18n.T("压缩包内不支持符号链接：%s", path))
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func tarGz(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 解压目录放在root/install下，检查root下是否有文件被写到解压目录之外
+func extractDirs(t *testing.T) (string, string) {
+	root, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "install")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return root, dir
+}
+
+func assertOnlyInstallDir(t *testing.T, root string) {
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name() != "install" {
+			t.Fatalf("%s was written outside the install dir", f.Name())
+		}
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	root, dir := extractDirs(t)
+	defer os.RemoveAll(root)
+	data := tarGz(t, []tarEntry{
+		{name: "bin/", typeflag: tar.TypeDir},
+		{name: "bin/plugin", typeflag: tar.TypeReg, body: "#!/bin/sh"},
+		{name: "README", typeflag: tar.TypeReg, body: "readme"},
+	})
+	if err := ExtractTarGz(bytes.NewReader(data), dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "bin", "plugin"))
+	if err != nil || string(b) != "#!/bin/sh" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	assertOnlyInstallDir(t, root)
+}
+
+func TestExtractTarGzRejectsUnsafeEntries(t *testing.T) {
+	cases := map[string][]tarEntry{
+		// 每个链接单独检查都指向解压目录内，组合后evil被写到解压目录之外
+		"chained symlinks": {
+			{name: "d/", typeflag: tar.TypeDir},
+			{name: "d/l", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "d/l/l2", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "d/l/l2/evil", typeflag: tar.TypeReg, body: "evil"},
+		},
+		"symlink then file": {
+			{name: "l", typeflag: tar.TypeSymlink, linkname: "../evil"},
+			{name: "l", typeflag: tar.TypeReg, body: "evil"},
+		},
+		"hard link": {
+			{name: "l", typeflag: tar.TypeLink, linkname: "../evil"},
+		},
+		"parent path": {
+			{name: "../evil", typeflag: tar.TypeReg, body: "evil"},
+		},
+		"absolute path": {
+			{name: "/evil", typeflag: tar.TypeReg, body: "evil"},
+		},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			root, dir := extractDirs(t)
+			defer os.RemoveAll(root)
+			if err := ExtractTarGz(bytes.NewReader(tarGz(t, entries)), dir); err == nil {
+				t.Fatal("expected an error")
+			}
+			assertOnlyInstallDir(t, root)
+		})
+	}
+}
+
+func TestExtractZipRejectsParentPath(t *testing.T) {
+	root, dir := extractDirs(t)
+	defer os.RemoveAll(root)
+	archive := filepath.Join(dir, "plugin.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("../evil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("evil"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := ExtractZip(archive, dir); err == nil {
+		t.Fatal("expected an error")
+	}
+	assertOnlyInstallDir(t, root)
+}
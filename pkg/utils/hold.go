@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var releaseTagRegexp = regexp.MustCompile(`^v\d+(\.\d+){1,2}-\d+$`)
+
+// 判断是否为完整的release tag，例：v1.9-10 v1.8.2-3
+func IsReleaseTag(tag string) bool {
+	return releaseTagRegexp.MatchString(tag)
+}
+
+// 解析组件版本锁定配置，每项格式为 组件名=tag 或 组件名=大版本号
+// 例：website=v1.9-10 锁定到指定tag，website=v1.8 锁定到v1.8下最新版本
+func ParseHolds(lines []string) (map[string]string, error) {
+	holds := map[string]string{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, errors.New(i18n.T("组件版本锁定格式不正确，应为 组件名=tag：%s", line))
+		}
+		holds[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return holds, nil
+}
+
+// 读取组件版本锁定文件，文件中每行一项，#开头为注释
+func ReadHoldFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	buf := bufio.NewReader(f)
+	for {
+		b, err := buf.ReadString('\n')
+		if b != "" {
+			lines = append(lines, strings.TrimRight(b, "\r\n"))
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+	}
+	return ParseHolds(lines)
+}
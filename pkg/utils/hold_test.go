@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsReleaseTag(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"v1.9-10":   true,
+		"v1.8.2-3":  true,
+		"v1.9":      false,
+		"1.9-10":    false,
+		"v1.9-10-x": false,
+		"latest":    false,
+	} {
+		if got := IsReleaseTag(tag); got != want {
+			t.Errorf("IsReleaseTag(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestParseHolds(t *testing.T) {
+	holds, err := ParseHolds([]string{"", "# 注释", " website = v1.9-10 ", "moebius/release/gateway=v1.8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 2 || holds["website"] != "v1.9-10" || holds["moebius/release/gateway"] != "v1.8" {
+		t.Fatalf("got %v", holds)
+	}
+	for _, line := range []string{"website", "website=", "=v1.9-10"} {
+		if _, err := ParseHolds([]string{line}); err == nil {
+			t.Errorf("ParseHolds(%q): expected an error", line)
+		}
+	}
+}
+
+func TestReadHoldFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hold.conf")
+	// 最后一行没有换行符，windows换行符
+	if err := ioutil.WriteFile(path, []byte("# 锁定\r\nwebsite=v1.9-10\r\ngateway=v1.8"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	holds, err := ReadHoldFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 2 || holds["website"] != "v1.9-10" || holds["gateway"] != "v1.8" {
+		t.Fatalf("got %v", holds)
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// release目录中的镜像锁定文件名称，kubectl apply -f 不会读取该文件
+const ReleaseLockFile = "release.lock"
+
+// 在release目录下生成release.lock
+func WriteReleaseLock(releasePath, version, prefix string, images []*models.ReleaseImage) error {
+	lock := &models.ReleaseLock{
+		Version:   version,
+		Prefix:    prefix,
+		Generated: time.Now().Format(time.RFC3339),
+		Images:    images,
+	}
+	b, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(releasePath, ReleaseLockFile), b, os.ModePerm)
+}
+
+// 读取release.lock，路径为目录时查找目录下所有release.lock
+func ReadReleaseLocks(paths []string) ([]*models.ReleaseLock, error) {
+	files := []string{}
+	for _, p := range paths {
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if info == nil {
+				return err
+			}
+			if !info.IsDir() && (path == p || info.Name() == ReleaseLockFile) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	locks := []*models.ReleaseLock{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		lock := &models.ReleaseLock{}
+		if err := json.Unmarshal(b, lock); err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
@@ -2,8 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
 	"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -42,9 +43,15 @@ func VersionCompare(source, dst string) string {
 }
 
 func disassembleVersion(version string) (int, int, int, int, error) {
+	v1, v2, v3, v4 := -1, -1, -1, -1
+	if len(version) < 2 {
+		return v1, v2, v3, v4, fmt.Errorf(i18n.T("版本号格式不正确：%s"), version)
+	}
 	version1 := strings.Split(version[1:], "-")
 	version2 := strings.Split(version1[0], ".")
-	v1, v2, v3, v4 := -1, -1, -1, -1
+	if len(version1) < 2 || len(version2) < 2 {
+		return v1, v2, v3, v4, fmt.Errorf(i18n.T("版本号格式不正确：%s"), version)
+	}
 	v4, err := strconv.Atoi(version1[1])
 	if err != nil {
 		return v1, v2, v3, v4, err
@@ -68,10 +75,10 @@ func disassembleVersion(version string) (int, int, int, int, error) {
 
 // 将模板目录下的yaml文件迁移到release目录下
 func MoveYamlToReleaseDir(sourceDirPrefix, dstDirPrefix string, imageName string, yamlPath string) error {
-	log.Println("读取模板yaml文件: " + yamlPath)
+	logger.Debug(i18n.T("读取模板yaml文件"), "path", yamlPath)
 	b, err := ioutil.ReadFile(yamlPath)
 	if err != nil {
-		log.Println("读取模板yaml文件失败：" + err.Error())
+		logger.Error(i18n.T("读取模板yaml文件失败"), "path", yamlPath, "error", err)
 		return err
 	}
 
@@ -89,14 +96,14 @@ func MoveYamlToReleaseDir(sourceDirPrefix, dstDirPrefix string, imageName string
 	if err != nil {
 		err = os.MkdirAll(filepath, os.ModePerm)
 		if err != nil {
-			log.Println("创建release yaml目录失败:" + err.Error())
+			logger.Error(i18n.T("创建release yaml目录失败"), "path", filepath, "error", err)
 			return err
 		}
 	}
-	log.Println("生成yaml文件：" + releaseFile)
+	logger.Info(i18n.T("生成yaml文件"), "path", releaseFile)
 	err = ioutil.WriteFile(releaseFile, []byte(s1), os.ModePerm)
 	if err != nil {
-		log.Println("yaml文件写入失败: " + err.Error())
+		logger.Error(i18n.T("yaml文件写入失败"), "path", releaseFile, "error", err)
 		return err
 	}
 	return nil
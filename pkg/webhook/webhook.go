@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// 镜像推送事件
+type Push struct {
+	Repository string // 镜像名称，不含域名
+	Tag        string
+	Digest     string
+	Source     string // harbor/nexus/registry
+}
+
+type harborPayload struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceUrl string `json:"resource_url"`
+		} `json:"resources"`
+		Repository struct {
+			Name         string `json:"name"`
+			Namespace    string `json:"namespace"`
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// 解析harbor webhook，支持1.x的pushImage与2.x的PUSH_ARTIFACT
+func ParseHarbor(body []byte) ([]*Push, error) {
+	var p harborPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.Type != "pushImage" && p.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	repository := p.EventData.Repository.RepoFullName
+	if repository == "" && p.EventData.Repository.Name != "" {
+		repository = p.EventData.Repository.Namespace + "/" + p.EventData.Repository.Name
+	}
+	pushes := []*Push{}
+	for _, r := range p.EventData.Resources {
+		if r.Tag == "" {
+			continue
+		}
+		push := &Push{Repository: repository, Tag: r.Tag, Digest: r.Digest, Source: "harbor"}
+		if push.Repository == "" {
+			// resource_url 格式 host/project/name:tag
+			url := strings.TrimSuffix(r.ResourceUrl, ":"+r.Tag)
+			if i := strings.Index(url, "/"); i >= 0 {
+				push.Repository = url[i+1:]
+			}
+		}
+		pushes = append(pushes, push)
+	}
+	return pushes, nil
+}
+
+type nexusPayload struct {
+	Action    string `json:"action"`
+	Component *struct {
+		Format  string `json:"format"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"component"`
+	Asset *struct {
+		Format string `json:"format"`
+		Name   string `json:"name"`
+	} `json:"asset"`
+}
+
+// 解析nexus repository webhook，支持component与asset事件
+func ParseNexus(body []byte) ([]*Push, error) {
+	var p nexusPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.Action != "CREATED" && p.Action != "UPDATED" {
+		return nil, nil
+	}
+	if p.Component != nil && p.Component.Format == "docker" {
+		return []*Push{{Repository: p.Component.Name, Tag: p.Component.Version, Source: "nexus"}}, nil
+	}
+	// asset名称格式 v2/moebius/release/website/manifests/v1.9-3
+	if p.Asset != nil && p.Asset.Format == "docker" {
+		name := strings.TrimPrefix(p.Asset.Name, "v2/")
+		i := strings.LastIndex(name, "/manifests/")
+		if i < 0 {
+			return nil, nil
+		}
+		tag := name[i+len("/manifests/"):]
+		if strings.HasPrefix(tag, "sha256:") {
+			return nil, nil
+		}
+		return []*Push{{Repository: name[:i], Tag: tag, Source: "nexus"}}, nil
+	}
+	return nil, nil
+}
+
+type registryPayload struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+			Digest     string `json:"digest"`
+		} `json:"target"`
+	} `json:"events"`
+}
+
+// 解析registry v2 notification，只处理带tag的manifest推送
+func ParseRegistry(body []byte) ([]*Push, error) {
+	var p registryPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	pushes := []*Push{}
+	for _, e := range p.Events {
+		if e.Action != "push" || e.Target.Tag == "" {
+			continue
+		}
+		pushes = append(pushes, &Push{Repository: e.Target.Repository, Tag: e.Target.Tag, Digest: e.Target.Digest, Source: "registry"})
+	}
+	return pushes, nil
+}
+
+// 校验nexus webhook签名，X-Nexus-Webhook-Signature为hex(hmac_sha1(secret, body))
+func VerifyNexusSignature(secret string, body []byte, signature string) bool {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(signature)))
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/plugin"
+	"github.com/antmoveh/micro-version-management/pkg/release"
+	"github.com/antmoveh/micro-version-management/pkg/repository"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 插件列表地址参数，与--plugin-config中的来源合并，靠前的地址优先
+var pluginUrlFlag = cli.StringFlag{
+	Name:   "url",
+	Usage:  "插件列表地址，多个地址用逗号分隔，可以是http/https地址、本地文件或目录",
+	EnvVar: "APP_PLUGIN_URL",
+}
+
+// 插件安装目录参数，install/list/upgrade共用
+var pluginDirFlag = cli.StringFlag{
+	Name:   "dir",
+	Usage:  "插件安装目录，默认为用户主目录下的.app/plugins，已安装插件记录在该目录下plugins.json",
+	EnvVar: "APP_PLUGIN_DIR",
+}
+
+// 平台版本参数，插件列表中声明compatible的版本只有兼容该版本时才会被选择
+var pluginPlatformFlag = cli.StringFlag{
+	Name:   "platform",
+	Usage:  "平台版本，如v1.9，指定后只选择compatible兼容该版本的插件",
+	EnvVar: "APP_PLATFORM_VERSION",
+}
+
+// 允许安装未提供sha256的插件，install/upgrade共用
+var pluginAllowUnverifiedFlag = cli.BoolFlag{
+	Name:  "allow-unverified",
+	Usage: "允许安装插件列表未提供sha256的插件，不校验下载内容",
+}
+
+var pluginInstallCommand = cli.Command{
+	Name:      "install",
+	Usage:     "下载并安装插件: app plugin install -url http://... mysql --version 1.2.0-3_x86",
+	ArgsUsage: "<插件名称>",
+	Flags: []cli.Flag{
+		pluginUrlFlag,
+		cli.StringFlag{
+			Name:  "version",
+			Usage: "插件版本或版本约束，如1.2.0-3_x86、>=1.2.0, <2.0，默认最新版本",
+		},
+		pluginDirFlag,
+		pluginPlatformFlag,
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "已安装相同版本时重新安装",
+		},
+		pluginAllowUnverifiedFlag,
+	},
+
+	Action: func(context *cli.Context) error {
+
+		installRequest := &models.PluginInstall{
+			Url:      context.String("url"),
+			Name:     context.Args().Get(0),
+			Version:  context.String("version"),
+			Dir:      pluginDir(context),
+			Force:    context.Bool("force"),
+			Platform: context.String("platform"),
+
+			AllowUnverified: context.Bool("allow-unverified"),
+		}
+		if installRequest.Name == "" {
+			fatal(i18n.T("必须指定插件名称，例：app plugin install -url http://... mysql"))
+		}
+		installPlugin(installRequest)
+		return nil
+	},
+}
+
+var pluginListCommand = cli.Command{
+	Name:  "list",
+	Usage: "列出插件列表中的插件最新版本，--installed列出已安装插件: app plugin list --installed -url http://...",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "url",
+			Usage:  "插件列表地址，多个地址用逗号分隔；--installed时可选，配置了插件列表来源时比较已安装版本与最新版本",
+			EnvVar: "APP_PLUGIN_URL",
+		},
+		pluginDirFlag,
+		cli.BoolFlag{
+			Name:  "installed",
+			Usage: "列出已安装插件",
+		},
+		pluginPlatformFlag,
+	},
+
+	Action: func(context *cli.Context) error {
+
+		url, dir, platform := context.String("url"), pluginDir(context), context.String("platform")
+		if context.Bool("installed") {
+			listInstalledPlugins(url, dir, platform)
+			return nil
+		}
+		plugins, err := releaseClient.LatestPlugins(appContext, &models.PluginSearch{Url: url, Platform: platform})
+		if err != nil {
+			fatal(err)
+		}
+		for _, pl := range plugins {
+			fmt.Println(pl.Name + " " + pl.Version)
+		}
+		return nil
+	},
+}
+
+var pluginUpgradeCommand = cli.Command{
+	Name:      "upgrade",
+	Usage:     "升级已安装插件到插件列表中的最新版本: app plugin upgrade -url http://... mysql 或 --all，--check只检查不升级",
+	ArgsUsage: "[插件名称]",
+	Flags: []cli.Flag{
+		pluginUrlFlag,
+		pluginDirFlag,
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "升级所有已安装插件",
+		},
+		cli.BoolFlag{
+			Name:  "check",
+			Usage: "只输出可升级的插件，不升级",
+		},
+		pluginPlatformFlag,
+		pluginAllowUnverifiedFlag,
+	},
+
+	Action: func(context *cli.Context) error {
+
+		url, name := context.String("url"), context.Args().Get(0)
+		if name == "" && !context.Bool("all") {
+			fatal(i18n.T("必须指定插件名称或--all，例：app plugin upgrade -url http://... mysql"))
+		}
+		manager := plugin.New(pluginDir(context))
+		manager.AllowUnverified = context.Bool("allow-unverified")
+		upgradePlugins(manager, url, context.String("platform"), name, context.Bool("check"))
+		return nil
+	},
+}
+
+var pluginIndexCommand = cli.Command{
+	Name:  "index",
+	Usage: "生成与校验插件列表",
+	Subcommands: []cli.Command{
+		pluginIndexBuildCommand,
+		pluginIndexValidateCommand,
+	},
+}
+
+var pluginIndexBuildCommand = cli.Command{
+	Name:  "build",
+	Usage: "按目录中的插件安装包生成或更新插件列表: app plugin index build --dir /data/plugins --base-url http://.../plugins",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "dir",
+			Usage: "插件安装包目录，文件名为<插件名称>-<版本>.tar.gz/.tgz/.zip，<插件名称>.description为插件描述",
+		},
+		cli.StringFlag{
+			Name:  "base-url",
+			Usage: "下载地址前缀，下载地址为前缀加文件名",
+		},
+		cli.StringFlag{
+			Name:  "o",
+			Usage: "插件列表文件，默认为安装包目录下index.json，已存在时在其基础上更新",
+		},
+		cli.BoolFlag{
+			Name:  "prune",
+			Usage: "删除目录中不存在安装包的版本",
+		},
+	},
+
+	Action: func(context *cli.Context) error {
+
+		buildRequest := &models.PluginIndexBuild{
+			Dir:     context.String("dir"),
+			BaseUrl: context.String("base-url"),
+			Output:  context.String("o"),
+			Prune:   context.Bool("prune"),
+		}
+		if buildRequest.Dir == "" || buildRequest.BaseUrl == "" {
+			fatal(i18n.T("必须指定安装包目录--dir与下载地址前缀--base-url"))
+		}
+		if buildRequest.Output == "" {
+			buildRequest.Output = filepath.Join(buildRequest.Dir, "index.json")
+		}
+		buildPluginIndex(buildRequest)
+		return nil
+	},
+}
+
+var pluginIndexValidateCommand = cli.Command{
+	Name:      "validate",
+	Usage:     "校验插件列表格式、版本、下载地址、sha256与依赖: app plugin index validate index.json",
+	ArgsUsage: "<插件列表文件或地址>",
+
+	Action: func(context *cli.Context) error {
+
+		index := context.Args().Get(0)
+		if index == "" {
+			fatal(i18n.T("必须指定插件列表文件或地址，例：app plugin index validate index.json"))
+		}
+		validatePluginIndex(index)
+		return nil
+	},
+}
+
+// --dir未指定时使用默认插件安装目录
+func pluginDir(context *cli.Context) string {
+	if dir := context.String("dir"); dir != "" {
+		return dir
+	}
+	dir, err := plugin.DefaultDir()
+	if err != nil {
+		fatal(i18n.T("无法确定插件安装目录，请通过--dir指定：%s", err))
+	}
+	return dir
+}
+
+// 解析插件及其依赖，按依赖顺序安装需要安装或变更版本的插件
+func installPlugin(installRequest *models.PluginInstall) {
+	manager := plugin.New(installRequest.Dir)
+	manager.AllowUnverified = installRequest.AllowUnverified
+	state, err := manager.Installed()
+	if err != nil {
+		fatal(err)
+	}
+	resolved, err := releaseClient.ResolvePlugins(appContext, installRequest.Url, installRequest.Platform, state.Plugins, map[string]string{installRequest.Name: installRequest.Version})
+	if err != nil {
+		fatal(err)
+	}
+	for _, p := range resolved {
+		if p.Changed() || (p.Detail.Name == installRequest.Name && installRequest.Force) {
+			if err := manager.CheckVerifiable(p.Detail, p.Version); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	for _, p := range resolved {
+		requested := p.Detail.Name == installRequest.Name
+		if !requested && !p.Changed() {
+			continue
+		}
+		if p.Changed() && p.Installed != nil {
+			if release.PluginSuffix(p.Installed.Version) != release.PluginSuffix(p.Version.Version) {
+				logger.Warn(i18n.T("插件版本后缀(架构)将变更"), "plugin", p.Detail.Name, "installed", p.Installed.Version, "version", p.Version.Version)
+			} else if !release.PluginNewer(p.Installed.Version, p.Version.Version) {
+				logger.Warn(i18n.T("插件版本将降级"), "plugin", p.Detail.Name, "installed", p.Installed.Version, "version", p.Version.Version)
+			}
+		}
+		installed, err := manager.Install(appContext, p.Detail, p.Version, requested && installRequest.Force)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(installed.Name + " " + installed.Version + " " + installed.Dir)
+	}
+}
+
+// 输出已安装插件，配置了插件列表来源时同时输出最新版本
+func listInstalledPlugins(url, dir, platform string) {
+	state, err := plugin.New(dir).Installed()
+	if err != nil {
+		fatal(err)
+	}
+	if !releaseClient.HasPluginSources(url) {
+		for _, pl := range state.Plugins {
+			fmt.Println(pl.Name + " " + pl.Version + " " + pl.Dir)
+		}
+		return
+	}
+	updates, err := releaseClient.CheckPlugins(appContext, url, platform, state.Plugins)
+	if err != nil {
+		fatal(err)
+	}
+	for _, u := range updates {
+		printPluginUpdate(u)
+	}
+}
+
+func printPluginUpdate(u *release.PluginUpdate) {
+	switch {
+	case u.Latest == nil:
+		fmt.Println(i18n.T("%s %s (插件列表中未查询到)", u.Installed.Name, u.Installed.Version))
+	case u.Outdated():
+		fmt.Println(i18n.T("%s %s -> %s (可升级)", u.Installed.Name, u.Installed.Version, u.Latest.Version))
+	default:
+		fmt.Println(i18n.T("%s %s (已是最新版本)", u.Installed.Name, u.Installed.Version))
+	}
+}
+
+// 输出解析结果，done为true时为已完成的变更
+func printResolvedPlugin(p *release.ResolvedPlugin, done bool) {
+	switch {
+	case p.Missing:
+		fmt.Println(i18n.T("%s %s (插件列表中未查询到)", p.Installed.Name, p.Installed.Version))
+	case p.Installed == nil && done:
+		fmt.Println(i18n.T("%s %s (已安装依赖)", p.Detail.Name, p.Version.Version))
+	case p.Installed == nil:
+		fmt.Println(i18n.T("%s %s (需安装依赖)", p.Detail.Name, p.Version.Version))
+	case !p.Changed():
+		fmt.Println(i18n.T("%s %s (已是最新版本)", p.Installed.Name, p.Installed.Version))
+	case release.PluginNewer(p.Installed.Version, p.Version.Version) && done:
+		fmt.Println(i18n.T("%s %s -> %s (已升级)", p.Installed.Name, p.Installed.Version, p.Version.Version))
+	case release.PluginNewer(p.Installed.Version, p.Version.Version):
+		fmt.Println(i18n.T("%s %s -> %s (可升级)", p.Installed.Name, p.Installed.Version, p.Version.Version))
+	case done:
+		fmt.Println(i18n.T("%s %s -> %s (已变更)", p.Installed.Name, p.Installed.Version, p.Version.Version))
+	default:
+		fmt.Println(i18n.T("%s %s -> %s (需变更)", p.Installed.Name, p.Installed.Version, p.Version.Version))
+	}
+}
+
+// 将name或所有已安装插件升级到满足依赖与平台版本的最新版本，其他插件按需变更，check为true时只输出解析结果
+func upgradePlugins(manager *plugin.Manager, url, platform, name string, check bool) {
+	state, err := manager.Installed()
+	if err != nil {
+		fatal(err)
+	}
+	requests := map[string]string{}
+	for _, pl := range state.Plugins {
+		if name == "" || pl.Name == name {
+			requests[pl.Name] = ""
+		}
+	}
+	if name != "" && len(requests) == 0 {
+		fatal(i18n.T("插件未安装：%s", name))
+	}
+	resolved, err := releaseClient.ResolvePlugins(appContext, url, platform, state.Plugins, requests)
+	if err != nil {
+		fatal(err)
+	}
+	failed := 0
+	for _, p := range resolved {
+		if p.Missing || !p.Changed() {
+			if _, ok := requests[p.Detail.Name]; ok {
+				printResolvedPlugin(p, false)
+			}
+			continue
+		}
+		if check {
+			printResolvedPlugin(p, false)
+			continue
+		}
+		if _, err := manager.Install(appContext, p.Detail, p.Version, false); err != nil {
+			if appContext.Err() != nil {
+				fatal(err)
+			}
+			logger.Error(i18n.T("插件升级失败"), "plugin", p.Detail.Name, "error", err)
+			failed++
+			continue
+		}
+		printResolvedPlugin(p, true)
+	}
+	if failed > 0 {
+		fatal(i18n.T("%d个插件升级失败", failed))
+	}
+}
+
+// 生成插件列表，校验通过后写入文件
+func buildPluginIndex(buildRequest *models.PluginIndexBuild) {
+	var existing *models.PluginList
+	b, err := ioutil.ReadFile(buildRequest.Output)
+	if err == nil {
+		if existing, err = repository.DecodePluginIndex(b); err != nil {
+			fatal(i18n.T("解析插件列表失败：%s", err))
+		}
+	} else if !os.IsNotExist(err) {
+		fatal(err)
+	}
+	list, err := release.BuildPluginIndex(buildRequest, existing)
+	if err != nil {
+		fatal(err)
+	}
+	b, err = repository.EncodePluginIndex(list, buildRequest.Output)
+	if err != nil {
+		fatal(err)
+	}
+	if _, problems := release.ValidatePluginIndex(b); len(problems) > 0 {
+		printIndexProblems(problems)
+	}
+	tmp := buildRequest.Output + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		fatal(err)
+	}
+	if err := os.Rename(tmp, buildRequest.Output); err != nil {
+		fatal(err)
+	}
+	versions := 0
+	for _, pl := range list.Plugins {
+		versions += len(pl.Versions)
+	}
+	logger.Info(i18n.T("插件列表已生成"), "file", buildRequest.Output, "plugins", len(list.Plugins), "versions", versions)
+	fmt.Println(buildRequest.Output)
+}
+
+// 校验本地文件或http地址的插件列表
+func validatePluginIndex(index string) {
+	var b []byte
+	if strings.HasPrefix(index, "http://") || strings.HasPrefix(index, "https://") {
+		buf := &bytes.Buffer{}
+		if err := repository.Download(appContext, index, buf); err != nil {
+			fatal(err)
+		}
+		b = buf.Bytes()
+	} else {
+		var err error
+		if b, err = ioutil.ReadFile(index); err != nil {
+			fatal(err)
+		}
+	}
+	list, problems := release.ValidatePluginIndex(b)
+	if len(problems) > 0 {
+		printIndexProblems(problems)
+	}
+	logger.Info(i18n.T("插件列表校验通过"), "plugins", len(list.Plugins))
+}
+
+func printIndexProblems(problems []string) {
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	fatal(fmt.Errorf(i18n.T("%w：%d处不符合"), release.ErrInvalidIndex, len(problems)))
+}
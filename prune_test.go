@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"sort"
+	"testing"
+)
+
+func imageTags(digests map[string]string) []*models.ImageTags {
+	it := []*models.ImageTags{}
+	for tag, digest := range digests {
+		it = append(it, &models.ImageTags{ImageName: "moebius/release/website", ImageTag: tag, Digest: digest, Source: models.Harbor})
+	}
+	return it
+}
+
+func tagNames(it []*models.ImageTags) []string {
+	names := []string{}
+	for _, t := range it {
+		names = append(names, t.ImageTag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPruneCandidatesKeepsSharedDigests(t *testing.T) {
+	it := imageTags(map[string]string{
+		"v1.9-5": "sha256:e",
+		"v1.9-4": "sha256:d",
+		"v1.9-3": "sha256:c",
+		// v1.9-2与release.lock引用的v1.9-1指向同一镜像
+		"v1.9-2": "sha256:a",
+		"v1.9-1": "sha256:a",
+		// 与不符合release tag格式的latest指向同一镜像
+		"v1.8-1": "sha256:b",
+		"latest": "sha256:b",
+	})
+	locked := map[string]bool{"moebius/release/website:v1.9-1": true}
+	digest := tagDigest(&models.Search{Type: models.Harbor, Name: "moebius/release/website"})
+
+	remove, err := pruneCandidates("moebius/release/website", it, locked, "", 1, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tagNames(remove); len(got) != 2 || got[0] != "v1.9-3" || got[1] != "v1.9-4" {
+		t.Fatalf("got %v, want [v1.9-3 v1.9-4]", got)
+	}
+
+	// 不按digest删除的仓库只排除release.lock引用的tag
+	remove, err = pruneCandidates("moebius/release/website", it, locked, "", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tagNames(remove); len(got) != 3 || got[0] != "v1.9-2" {
+		t.Fatalf("got %v, want [v1.9-2 v1.9-3 v1.9-4]", got)
+	}
+}
+
+func TestPruneCandidatesRequiresHarborDigest(t *testing.T) {
+	it := imageTags(map[string]string{"v1.9-2": "sha256:b", "v1.9-1": ""})
+	digest := tagDigest(&models.Search{Type: models.Harbor, Name: "moebius/release/website"})
+	if _, err := pruneCandidates("moebius/release/website", it, nil, "", 1, digest); err == nil {
+		t.Fatal("expected an error when harbor returns no digest")
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/antmoveh/micro-version-management/pkg/i18n"
+	"github.com/antmoveh/micro-version-management/pkg/logger"
+	"github.com/antmoveh/micro-version-management/pkg/metrics"
+	"github.com/antmoveh/micro-version-management/pkg/models"
+	"github.com/antmoveh/micro-version-management/pkg/utils"
+	"github.com/antmoveh/micro-version-management/pkg/webhook"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var serveCommand = cli.Command{
+	Name:  "serve",
+	Usage: "接收镜像仓库推送webhook并触发动作，提供search/plugin/release的http接口: app serve --listen :8080 --action release -t nexus -url http://username:password/xxx -v v1.9 -f /tmp/template -o /tmp/release",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "listen",
+			Usage: "监听地址",
+			Value: ":8080",
+		},
+		cli.StringFlag{
+			Name:   "webhook-secret",
+			Usage:  "webhook认证：harbor/registry比较Authorization请求头，nexus校验X-Nexus-Webhook-Signature签名",
+			EnvVar: "APP_WEBHOOK_SECRET",
+		},
+		cli.StringSliceFlag{
+			Name:  "action",
+			Usage: "收到release镜像推送后执行的动作，可重复使用：release重新生成release目录/notify发送image-pushed通知/exec执行--exec命令，默认notify",
+		},
+		cli.StringFlag{
+			Name:  "exec",
+			Usage: "exec动作执行的命令，环境变量IMAGE/REPOSITORY/TAG/DIGEST为推送的镜像",
+		},
+		cli.StringFlag{
+			Name:  "v",
+			Usage: "只处理指定版本: v1.9",
+		},
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "只处理以此开头的镜像,默认moebius/release/",
+		},
+		cli.StringFlag{
+			Name:  "t",
+			Usage: "release动作及/api接口使用的镜像仓库类型：nexus/harbor/dockerHub/registry",
+		},
+		cli.StringFlag{
+			Name:  "url",
+			Usage: "release动作及/api接口使用的镜像仓库门户页地址",
+		},
+		cli.StringFlag{
+			Name:  "f",
+			Usage: "release动作及/api/release使用的模板文件路径：默认值/tmp/template",
+		},
+		cli.StringFlag{
+			Name:  "o",
+			Usage: "release动作生成路径:默认值/tmp/release",
+		},
+		cli.StringFlag{
+			Name:  "domain",
+			Usage: "release动作生成镜像的域名，默认为空",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "release动作输出格式：raw/helm/kustomize，默认raw",
+		},
+		cli.StringFlag{
+			Name:  "plugin-url",
+			Usage: "/api/plugin 查询的插件列表地址",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "/api 接口认证token，请求头 Authorization: Bearer <token>",
+			EnvVar: "APP_API_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "basic-auth",
+			Usage:  "/api 接口basic认证，用户名:密码",
+			EnvVar: "APP_API_BASIC_AUTH",
+		},
+	},
+
+	Action: func(context *cli.Context) error {
+
+		serveRequest := &models.Serve{
+			Release: models.Release{
+				Type:         context.String("t"),
+				Url:          context.String("url"),
+				TemplatePath: context.String("f"),
+				ReleasePath:  context.String("o"),
+				Version:      context.String("v"),
+				Prefix:       context.String("prefix"),
+				Domain:       context.String("domain"),
+				Format:       context.String("format"),
+			},
+			Listen:        context.String("listen"),
+			WebhookSecret: context.String("webhook-secret"),
+			Actions:       context.StringSlice("action"),
+			Exec:          context.String("exec"),
+			Token:         context.String("token"),
+			BasicAuth:     context.String("basic-auth"),
+			PluginUrl:     context.String("plugin-url"),
+		}
+		if len(serveRequest.Actions) == 0 {
+			serveRequest.Actions = []string{models.ActionNotify}
+		}
+		for _, action := range serveRequest.Actions {
+			if action != models.ActionRelease && action != models.ActionNotify && action != models.ActionExec {
+				fatal(i18n.T("动作不正确，支持release/notify/exec：%s", action))
+			}
+			if action == models.ActionExec && serveRequest.Exec == "" {
+				fatal(i18n.T("exec动作必须指定--exec命令"))
+			}
+			// 未认证的webhook不能触发生成release目录或执行命令
+			if (action == models.ActionRelease || action == models.ActionExec) && serveRequest.WebhookSecret == "" {
+				fatal(i18n.T("release/exec动作必须指定--webhook-secret"))
+			}
+		}
+		if serveRequest.Prefix == "" {
+			serveRequest.Prefix = "moebius/release/"
+		}
+		if !strings.HasSuffix(serveRequest.Prefix, "/") {
+			serveRequest.Prefix = serveRequest.Prefix + "/"
+		}
+		serve(serveRequest)
+		return nil
+	},
+}
+
+type server struct {
+	request *models.Serve
+	jobs    chan func()
+
+	mu             sync.Mutex
+	releasePending bool
+}
+
+func serve(serveRequest *models.Serve) {
+	s := &server{request: serveRequest, jobs: make(chan func(), 64)}
+	// 动作按顺序在后台执行，避免同时生成release目录
+	go func() {
+		for job := range s.jobs {
+			job()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/harbor", s.webhookHandler("harbor", webhook.ParseHarbor))
+	mux.HandleFunc("/webhook/nexus", s.webhookHandler("nexus", webhook.ParseNexus))
+	mux.HandleFunc("/webhook/registry", s.webhookHandler("registry", webhook.ParseRegistry))
+	mux.HandleFunc("/api/tags", s.apiHandler(s.apiTags, false))
+	mux.HandleFunc("/api/latest", s.apiHandler(s.apiLatest, false))
+	mux.HandleFunc("/api/plugin", s.apiHandler(s.apiPlugin, false))
+	mux.HandleFunc("/api/release", s.apiHandler(s.apiRelease, true))
+	mux.Handle("/metrics", metrics.Handler())
+
+	// 收到退出信号时停止接收请求，进行中的请求随appContext取消
+	srv := &http.Server{
+		Addr:        serveRequest.Listen,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return appContext },
+	}
+	go func() {
+		<-appContext.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	logger.Info(i18n.T("启动服务"), "listen", serveRequest.Listen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fatal(err)
+	}
+	logger.Info(i18n.T("服务已停止"))
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *server) webhookHandler(source string, parse func([]byte) ([]*webhook.Push, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": i18n.T("只支持POST")})
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if !s.verifyWebhook(source, r, body) {
+			writeJson(w, http.StatusUnauthorized, map[string]string{"error": i18n.T("webhook认证失败")})
+			return
+		}
+		pushes, err := parse(body)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": i18n.T("webhook格式不正确：%s", err)})
+			return
+		}
+
+		accepted := []*webhook.Push{}
+		for _, push := range pushes {
+			if !s.matchPush(push) {
+				continue
+			}
+			logger.Info(i18n.T("收到release镜像推送"), "source", source, "image", push.Repository+":"+push.Tag)
+			// 删除该镜像的tag缓存，/api/latest等查询能返回新推送的tag
+			if err := tagCache.Delete(s.request.Type, s.request.Url, push.Repository); err != nil {
+				logger.Warn(i18n.T("删除tag缓存失败"), "image", push.Repository, "error", err)
+			}
+			accepted = append(accepted, push)
+		}
+		if len(accepted) > 0 && !s.trigger(accepted) {
+			logger.Warn(i18n.T("任务队列已满，拒绝webhook"), "source", source)
+			writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": i18n.T("任务队列已满，稍后重试")})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]int{"accepted": len(accepted)})
+	}
+}
+
+func (s *server) verifyWebhook(source string, r *http.Request, body []byte) bool {
+	secret := s.request.WebhookSecret
+	if secret == "" {
+		return true
+	}
+	if source == "nexus" {
+		return webhook.VerifyNexusSignature(secret, body, r.Header.Get("X-Nexus-Webhook-Signature"))
+	}
+	auth := []byte(r.Header.Get("Authorization"))
+	return subtle.ConstantTimeCompare(auth, []byte(secret)) == 1 || subtle.ConstantTimeCompare(auth, []byte("Bearer "+secret)) == 1
+}
+
+// 只处理release前缀下符合版本规则的tag
+func (s *server) matchPush(push *webhook.Push) bool {
+	if !strings.HasPrefix(push.Repository, s.request.Prefix) || !utils.IsReleaseTag(push.Tag) {
+		return false
+	}
+	return s.request.Version == "" || strings.HasPrefix(push.Tag, s.request.Version+"-")
+}
+
+// 加入任务队列，队列已满时返回false，不阻塞请求
+func (s *server) enqueue(job func()) bool {
+	select {
+	case s.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// 按配置的动作加入任务队列，有任务因队列已满未加入时返回false
+func (s *server) trigger(pushes []*webhook.Push) bool {
+	ok := true
+	for _, action := range s.request.Actions {
+		switch action {
+		case models.ActionRelease:
+			// 等待执行的release只保留一个，连续推送只重新生成一次
+			s.mu.Lock()
+			pending := s.releasePending
+			s.releasePending = true
+			s.mu.Unlock()
+			if !pending && !s.enqueue(s.runRelease) {
+				s.mu.Lock()
+				s.releasePending = false
+				s.mu.Unlock()
+				ok = false
+			}
+		case models.ActionNotify:
+			for _, push := range pushes {
+				event := &models.NotifyEvent{
+					Type:    models.EventImagePushed,
+					Version: s.request.Version,
+					Image:   push.Repository,
+					NewTag:  push.Tag,
+				}
+				if !s.enqueue(func() { _ = notifier.Send(appContext, event) }) {
+					ok = false
+				}
+			}
+		case models.ActionExec:
+			for _, push := range pushes {
+				p := push
+				if !s.enqueue(func() { s.runExec(p) }) {
+					ok = false
+				}
+			}
+		}
+	}
+	return ok
+}
+
+// 重新生成release目录，使用配置的副本避免修改默认值
+func (s *server) runRelease() {
+	s.mu.Lock()
+	s.releasePending = false
+	s.mu.Unlock()
+
+	logger.Info(i18n.T("重新生成release目录"))
+	releaseRequest := s.request.Release
+	// 推送前缓存的tag列表不包含新推送的tag
+	releaseRequest.Fresh = true
+	if _, err := releaseClient.Generate(appContext, &releaseRequest); err != nil {
+		logger.Error(i18n.T("重新生成release目录失败"), "error", err)
+	}
+}
+
+func (s *server) runExec(push *webhook.Push) {
+	cmd := exec.CommandContext(appContext, "sh", "-c", s.request.Exec)
+	cmd.Env = append(os.Environ(),
+		"IMAGE="+push.Repository+":"+push.Tag,
+		"REPOSITORY="+push.Repository,
+		"TAG="+push.Tag,
+		"DIGEST="+push.Digest,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error(i18n.T("执行命令失败"), "error", err)
+	}
+}